@@ -0,0 +1,284 @@
+package dynamodb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// AttributeValue is a single DynamoDB value: exactly one of a string (S),
+// number (N), binary (B), string set (SS), number set (NS), binary set
+// (BS), list (L), map (M), boolean (BOOL) or null (NULL). The zero
+// AttributeValue holds none of them and cannot be sent; build values with
+// the ...Value constructors and read them with the As... accessors.
+type AttributeValue struct {
+	typ string
+	s   string // S, N
+	b   []byte // B
+	ss  []string
+	bs  [][]byte
+	l   []AttributeValue
+	m   map[string]AttributeValue
+	bl  bool
+}
+
+// StringValue returns an S value.
+func StringValue(s string) AttributeValue { return AttributeValue{typ: "S", s: s} }
+
+// NumberValue returns an N value; n is the number's decimal representation.
+func NumberValue(n string) AttributeValue { return AttributeValue{typ: "N", s: n} }
+
+// IntValue returns an N value holding i.
+func IntValue(i int64) AttributeValue { return NumberValue(strconv.FormatInt(i, 10)) }
+
+// BinaryValue returns a B value.
+func BinaryValue(b []byte) AttributeValue { return AttributeValue{typ: "B", b: b} }
+
+// StringSetValue returns an SS value.
+func StringSetValue(ss ...string) AttributeValue { return AttributeValue{typ: "SS", ss: ss} }
+
+// NumberSetValue returns an NS value.
+func NumberSetValue(ns ...string) AttributeValue { return AttributeValue{typ: "NS", ss: ns} }
+
+// BinarySetValue returns a BS value.
+func BinarySetValue(bs ...[]byte) AttributeValue { return AttributeValue{typ: "BS", bs: bs} }
+
+// ListValue returns an L value.
+func ListValue(l ...AttributeValue) AttributeValue { return AttributeValue{typ: "L", l: l} }
+
+// MapValue returns an M value.
+func MapValue(m map[string]AttributeValue) AttributeValue { return AttributeValue{typ: "M", m: m} }
+
+// BoolValue returns a BOOL value.
+func BoolValue(b bool) AttributeValue { return AttributeValue{typ: "BOOL", bl: b} }
+
+// NullValue returns a NULL value.
+func NullValue() AttributeValue { return AttributeValue{typ: "NULL"} }
+
+// Type returns the DynamoDB data type of v: "S", "N", "B", "SS", "NS",
+// "BS", "L", "M", "BOOL" or "NULL", or "" for the zero AttributeValue.
+func (v AttributeValue) Type() string { return v.typ }
+
+// IsZero reports whether v holds no value.
+func (v AttributeValue) IsZero() bool { return v.typ == "" }
+
+func (v AttributeValue) AsString() (string, bool) { return v.s, v.typ == "S" }
+
+func (v AttributeValue) AsNumber() (string, bool) { return v.s, v.typ == "N" }
+
+// AsInt returns v as an integer, reporting false if v is not an N value or
+// does not hold an int64.
+func (v AttributeValue) AsInt() (int64, bool) {
+	if v.typ != "N" {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(v.s, 10, 64)
+	return i, err == nil
+}
+
+func (v AttributeValue) AsBinary() ([]byte, bool) { return v.b, v.typ == "B" }
+
+func (v AttributeValue) AsStringSet() ([]string, bool) { return v.ss, v.typ == "SS" }
+
+func (v AttributeValue) AsNumberSet() ([]string, bool) { return v.ss, v.typ == "NS" }
+
+func (v AttributeValue) AsBinarySet() ([][]byte, bool) { return v.bs, v.typ == "BS" }
+
+func (v AttributeValue) AsList() ([]AttributeValue, bool) { return v.l, v.typ == "L" }
+
+func (v AttributeValue) AsMap() (map[string]AttributeValue, bool) { return v.m, v.typ == "M" }
+
+func (v AttributeValue) AsBool() (bool, bool) { return v.bl, v.typ == "BOOL" }
+
+func (v AttributeValue) IsNull() bool { return v.typ == "NULL" }
+
+// clone returns a deep copy of v, sharing no slices or maps with it.
+func (v AttributeValue) clone() AttributeValue {
+	if v.b != nil {
+		v.b = append([]byte(nil), v.b...)
+	}
+	if v.ss != nil {
+		v.ss = append([]string(nil), v.ss...)
+	}
+	if v.bs != nil {
+		bs := make([][]byte, len(v.bs))
+		for i, b := range v.bs {
+			bs[i] = append([]byte(nil), b...)
+		}
+		v.bs = bs
+	}
+	if v.l != nil {
+		l := make([]AttributeValue, len(v.l))
+		for i, e := range v.l {
+			l[i] = e.clone()
+		}
+		v.l = l
+	}
+	if v.m != nil {
+		v.m = cloneItem(v.m)
+	}
+	return v
+}
+
+// Equal reports whether v and w hold the same value. Sets are equal if
+// they have the same members in any order; numbers are compared by value.
+func (v AttributeValue) Equal(w AttributeValue) bool {
+	if v.typ != w.typ {
+		return false
+	}
+	switch v.typ {
+	case "S":
+		return v.s == w.s
+	case "N":
+		return numbersEqual(v.s, w.s)
+	case "B":
+		return bytes.Equal(v.b, w.b)
+	case "SS":
+		return setsEqual(v.ss, w.ss, func(a, b string) bool { return a == b })
+	case "NS":
+		return setsEqual(v.ss, w.ss, numbersEqual)
+	case "BS":
+		return setsEqual(v.bs, w.bs, bytes.Equal)
+	case "L":
+		if len(v.l) != len(w.l) {
+			return false
+		}
+		for i := range v.l {
+			if !v.l[i].Equal(w.l[i]) {
+				return false
+			}
+		}
+		return true
+	case "M":
+		if len(v.m) != len(w.m) {
+			return false
+		}
+		for k, x := range v.m {
+			if y, ok := w.m[k]; !ok || !x.Equal(y) {
+				return false
+			}
+		}
+		return true
+	case "BOOL":
+		return v.bl == w.bl
+	}
+	return true
+}
+
+func numbersEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	return errX == nil && errY == nil && x == y
+}
+
+func setsEqual[T any](a, b []T, equal func(T, T) bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	used := make([]bool, len(b))
+outer:
+	for _, x := range a {
+		for i, y := range b {
+			if !used[i] && equal(x, y) {
+				used[i] = true
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// String returns v in its JSON wire form, for logging and debugging.
+func (v AttributeValue) String() string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+func (v AttributeValue) MarshalJSON() ([]byte, error) {
+	var value interface{}
+	switch v.typ {
+	case "S", "N":
+		value = v.s
+	case "B":
+		value = v.b
+	case "SS", "NS":
+		value = v.ss
+	case "BS":
+		value = v.bs
+	case "L":
+		value = v.l
+		if v.l == nil {
+			value = []AttributeValue{}
+		}
+	case "M":
+		value = v.m
+		if v.m == nil {
+			value = map[string]AttributeValue{}
+		}
+	case "BOOL":
+		value = v.bl
+	case "NULL":
+		value = true
+	default:
+		return nil, errors.New("dynamodb: AttributeValue has no data type set")
+	}
+	return json.Marshal(map[string]interface{}{v.typ: value})
+}
+
+func (v *AttributeValue) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 1 {
+		types := make([]string, 0, len(fields))
+		for t := range fields {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return fmt.Errorf("dynamodb: AttributeValue must have exactly one data type, got %v", types)
+	}
+	var w AttributeValue
+	for t, raw := range fields {
+		w.typ = t
+		var err error
+		switch t {
+		case "S", "N":
+			err = json.Unmarshal(raw, &w.s)
+		case "B":
+			err = json.Unmarshal(raw, &w.b)
+		case "SS", "NS":
+			err = json.Unmarshal(raw, &w.ss)
+		case "BS":
+			err = json.Unmarshal(raw, &w.bs)
+		case "L":
+			err = json.Unmarshal(raw, &w.l)
+		case "M":
+			err = json.Unmarshal(raw, &w.m)
+		case "BOOL":
+			err = json.Unmarshal(raw, &w.bl)
+		case "NULL":
+			var null bool
+			if err = json.Unmarshal(raw, &null); err == nil && !null {
+				err = errors.New("dynamodb: NULL AttributeValue must be true")
+			}
+		default:
+			err = fmt.Errorf("dynamodb: unknown AttributeValue data type %q", t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	*v = w
+	return nil
+}
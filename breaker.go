@@ -0,0 +1,164 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting DynamoDB while a circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("dynamodb: circuit breaker is open")
+
+// BreakerState is the state of one circuit of a CircuitBreaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every request with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen lets a single probe through at a time.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker fails requests fast once too many of them fail. It keeps
+// a circuit per endpoint, or per table if PerTable is set. Only transient
+// failures, as classified by IsRetryable, count against a circuit.
+type CircuitBreaker struct {
+	ErrorRate   float64       // fraction of failed attempts that opens a circuit
+	MinRequests int           // attempts in Window before ErrorRate applies
+	Window      time.Duration // over which attempts are counted
+	CoolDown    time.Duration // how long a circuit stays open before probing
+	Probes      int           // successful probes needed to close
+	PerTable    bool
+
+	// OnStateChange, if set, is called whenever a circuit changes state.
+	// It must not call back into the CircuitBreaker.
+	OnStateChange func(circuit string, from, to BreakerState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	probes      int
+}
+
+// NewCircuitBreaker returns a breaker that opens once errorRate of at least
+// minRequests attempts within window fail, and probes again after coolDown.
+func NewCircuitBreaker(errorRate float64, minRequests int, window, coolDown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{ErrorRate: errorRate, MinRequests: minRequests, Window: window, CoolDown: coolDown, Probes: 1}
+}
+
+func (cb *CircuitBreaker) circuit(name string) *circuit {
+	if cb.circuits == nil {
+		cb.circuits = make(map[string]*circuit)
+	}
+	c, ok := cb.circuits[name]
+	if !ok {
+		c = &circuit{windowStart: time.Now()}
+		cb.circuits[name] = c
+	}
+	return c
+}
+
+// transition moves c to state; cb.mu must be held.
+func (cb *CircuitBreaker) transition(name string, c *circuit, state BreakerState) {
+	from := c.state
+	c.state = state
+	c.requests, c.failures, c.probes = 0, 0, 0
+	c.windowStart = time.Now()
+	if state == BreakerOpen {
+		c.openedAt = time.Now()
+	}
+	if cb.OnStateChange != nil && from != state {
+		cb.OnStateChange(name, from, state)
+	}
+}
+
+// Allow returns ErrCircuitOpen if an attempt on the named circuit should
+// not be made.
+func (cb *CircuitBreaker) Allow(name string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(name)
+	if c.state == BreakerOpen && time.Since(c.openedAt) >= cb.CoolDown {
+		cb.transition(name, c, BreakerHalfOpen)
+	}
+	switch c.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if c.probing {
+			return ErrCircuitOpen
+		}
+		c.probing = true
+	}
+	return nil
+}
+
+// Record reports the outcome of an attempt Allow let through.
+func (cb *CircuitBreaker) Record(name string, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c := cb.circuit(name)
+	failed := IsRetryable(err)
+	canceled := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+
+	switch c.state {
+	case BreakerHalfOpen:
+		c.probing = false
+		switch {
+		case canceled:
+		case failed:
+			cb.transition(name, c, BreakerOpen)
+		default:
+			c.probes++
+			if c.probes >= cb.Probes {
+				cb.transition(name, c, BreakerClosed)
+			}
+		}
+	case BreakerClosed:
+		if canceled {
+			return
+		}
+		if time.Since(c.windowStart) > cb.Window {
+			c.windowStart = time.Now()
+			c.requests, c.failures = 0, 0
+		}
+		c.requests++
+		if failed {
+			c.failures++
+		}
+		if c.requests >= cb.MinRequests && float64(c.failures) >= cb.ErrorRate*float64(c.requests) && c.failures > 0 {
+			cb.transition(name, c, BreakerOpen)
+		}
+	}
+}
+
+// State returns the current state of the named circuit.
+func (cb *CircuitBreaker) State(name string) BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.circuit(name).state
+}
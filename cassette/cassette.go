@@ -0,0 +1,198 @@
+// Package cassette records HTTP interactions to a file and replays them, so
+// that tests written against a live DynamoDB endpoint can run offline.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Mode int
+
+const (
+	// Replay serves recorded responses and fails requests that were not
+	// recorded.
+	Replay Mode = iota
+	// Record sends requests on and records them along with the responses.
+	Record
+)
+
+// ScrubbedHeaders are removed from recorded requests since they carry
+// credentials or signatures, or vary with every request.
+var ScrubbedHeaders = []string{"Authorization", "X-Amz-Security-Token", "X-Amz-Date", "X-Amz-Content-Sha256"}
+
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+}
+
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// ErrNotRecorded is returned in Replay mode for requests that match no
+// unused interaction.
+var ErrNotRecorded = errors.New("cassette: request not recorded")
+
+// Transport is an http.RoundTripper that records to or replays from the
+// cassette in Filename.
+type Transport struct {
+	Mode     Mode
+	Filename string
+
+	// Transport sends requests in Record mode; nil means
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// New returns a Transport for filename, loading the cassette when mode is
+// Replay.
+func New(filename string, mode Mode) (*Transport, error) {
+	t := &Transport{Mode: mode, Filename: filename}
+	if mode == Replay {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &t.interactions); err != nil {
+			return nil, fmt.Errorf("cassette: %s: %v", filename, err)
+		}
+		t.used = make([]bool, len(t.interactions))
+	}
+	return t, nil
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if t.Mode == Record {
+		return t.record(r, body)
+	}
+	return t.replay(r, body)
+}
+
+func (t *Transport) record(r *http.Request, body []byte) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	response, err := transport.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	header := r.Header.Clone()
+	for _, h := range ScrubbedHeaders {
+		header.Del(h)
+	}
+	responseHeader := response.Header.Clone()
+	if response.Uncompressed {
+		// The transport has decompressed b, so the headers describing
+		// the compressed body would not match it on replay.
+		responseHeader.Del("Content-Encoding")
+		responseHeader.Del("Content-Length")
+		if responseHeader.Get("X-Amz-Crc32") != "" {
+			responseHeader.Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE(b)), 10))
+		}
+	}
+	t.mu.Lock()
+	t.interactions = append(t.interactions, Interaction{
+		Request:  Request{Method: r.Method, URL: r.URL.String(), Header: header, Body: string(body)},
+		Response: Response{StatusCode: response.StatusCode, Header: responseHeader, Body: string(b)},
+	})
+	t.mu.Unlock()
+	return response, nil
+}
+
+// replay serves the first unused interaction whose method, URL, target and
+// body match r.
+func (t *Transport) replay(r *http.Request, body []byte) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, in := range t.interactions {
+		if t.used[i] || in.Request.Method != r.Method || in.Request.URL != r.URL.String() || in.Request.Body != string(body) || in.Request.Header.Get("X-Amz-Target") != r.Header.Get("X-Amz-Target") {
+			continue
+		}
+		t.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       r,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s %s", ErrNotRecorded, r.Method, r.URL, r.Header.Get("X-Amz-Target"))
+}
+
+// Save writes the interactions recorded so far to Filename.
+func (t *Transport) Save() error {
+	t.mu.Lock()
+	b, err := json.MarshalIndent(t.interactions, "", "  ")
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(t.Filename, append(b, '\n'), 0644)
+}
+
+// Unused returns the recorded interactions that have not been replayed.
+func (t *Transport) Unused() []Interaction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var unused []Interaction
+	for i, in := range t.interactions {
+		if !t.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return unused
+}
+
+// ModeFromEnv returns Record if the environment variable name is set to a
+// non-empty value, and Replay otherwise.
+func ModeFromEnv(name string) Mode {
+	if os.Getenv(name) != "" {
+		return Record
+	}
+	return Replay
+}
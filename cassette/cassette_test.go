@@ -0,0 +1,123 @@
+package cassette_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/eikeon/dynamodb"
+	"github.com/eikeon/dynamodb/cassette"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Item":{"Host":{"S":"example.com"}}}`)
+	}))
+	filename := filepath.Join(t.TempDir(), "cassette.json")
+	credentials := dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret", SessionToken: "token"}
+	key := dynamodb.Key{"Host": dynamodb.StringValue("example.com")}
+
+	recorder, err := cassette.New(filename, cassette.Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Endpoint: server.URL, Credentials: credentials, Transport: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetItem("T", key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	player, err := cassette.New(filename, cassette.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range player.Unused() {
+		for _, h := range cassette.ScrubbedHeaders {
+			if in.Request.Header.Get(h) != "" {
+				t.Errorf("%s was recorded", h)
+			}
+		}
+	}
+	config := dynamodb.Config{Endpoint: server.URL, Credentials: credentials, Transport: player}
+	config.RetryPolicy = &dynamodb.BackoffRetryPolicy{MaxAttempts: 1}
+	db, err = dynamodb.NewDynamoDBWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.GetItem("T", key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(*r.Item)["Host"].Equal(dynamodb.StringValue("example.com")) {
+		t.Errorf("replayed %v", r.Item)
+	}
+	if _, err := db.GetItem("T", key, nil); !errors.Is(err, cassette.ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded on a second replay, got %v", err)
+	}
+	if _, err := db.GetItem("Other", key, nil); err == nil || !strings.Contains(err.Error(), "not recorded") {
+		t.Errorf("expected an unrecorded request to fail, got %v", err)
+	}
+}
+
+func TestRecordCompressed(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	fmt.Fprint(w, `{"Item":{"Host":{"S":"example.com"}}}`)
+	w.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE(compressed.Bytes())), 10))
+		w.Write(compressed.Bytes())
+	}))
+	defer server.Close()
+	filename := filepath.Join(t.TempDir(), "cassette.json")
+	credentials := dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret"}
+	key := dynamodb.Key{"Host": dynamodb.StringValue("example.com")}
+
+	recorder, err := cassette.New(filename, cassette.Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Endpoint: server.URL, Credentials: credentials, Transport: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetItem("T", key, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := cassette.New(filename, cassette.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := dynamodb.Config{Endpoint: server.URL, Credentials: credentials, Transport: player}
+	config.RetryPolicy = &dynamodb.BackoffRetryPolicy{MaxAttempts: 1}
+	db, err = dynamodb.NewDynamoDBWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.GetItem("T", key, nil)
+	if err != nil {
+		t.Fatalf("replaying a decompressed response: %v", err)
+	}
+	if !(*r.Item)["Host"].Equal(dynamodb.StringValue("example.com")) {
+		t.Errorf("replayed %v", r.Item)
+	}
+}
@@ -0,0 +1,40 @@
+// Command dynamodb-local serves the DynamoDB JSON 1.0 protocol from an
+// in-memory database, for testing programs in any language without AWS.
+//
+//	dynamodb-local -addr :8000
+//
+// Point clients at http://localhost:8000. Signatures are only checked when
+// -access-key and -secret-key are given.
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/eikeon/dynamodb"
+)
+
+func main() {
+	addr := flag.String("addr", ":8000", "address to listen on")
+	accessKey := flag.String("access-key", "", "access key id requests must be signed with")
+	secretKey := flag.String("secret-key", "", "secret access key requests must be signed with")
+	verbose := flag.Bool("v", false, "log failed requests")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	config := dynamodb.Config{}
+	if *verbose {
+		config.Logger = logger
+	}
+	server := dynamodb.NewServer(dynamodb.NewMemoryDBWithConfig(config))
+	server.Logger = config.Logger
+	if *accessKey != "" || *secretKey != "" {
+		server.Credentials = dynamodb.StaticCredentials{AccessKeyID: *accessKey, SecretAccessKey: *secretKey}
+	}
+
+	logger.Info("listening", "addr", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
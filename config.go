@@ -0,0 +1,109 @@
+package dynamodb
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The region used when a Config does not name one.
+const DefaultRegion = "us-east-1"
+
+// Config describes how a client reaches and authenticates against DynamoDB.
+// The zero value talks to DefaultRegion over https using
+// DefaultCredentials.
+type Config struct {
+	// Region is used both to pick the regional endpoint and as the region
+	// in the signature's credential scope.
+	Region string
+
+	// Endpoint overrides the regional endpoint, e.g. "localhost:8000" for
+	// DynamoDB Local. A scheme prefix such as "http://" is honored.
+	Endpoint string
+
+	// Scheme is "https" unless set otherwise.
+	Scheme string
+
+	// Credentials sign each request; nil means DefaultCredentials.
+	Credentials CredentialsProvider
+
+	// HTTPClient sends the requests, unmodified. If nil, a client using
+	// Transport is created.
+	HTTPClient *http.Client
+
+	// Transport is used when HTTPClient is nil; nil means a clone of
+	// http.DefaultTransport keeping up to 100 idle connections to the
+	// endpoint.
+	Transport http.RoundTripper
+
+	// AttemptTimeout bounds each attempt, as opposed to the whole
+	// operation which is bounded by its context; 0 means no bound.
+	AttemptTimeout time.Duration
+
+	// RetryPolicy decides which failed requests are retried and when;
+	// nil means DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+
+	// RateLimiter, if set, paces single table item operations by the
+	// capacity they consume.
+	RateLimiter *RateLimiter
+
+	// CircuitBreaker, if set, fails requests fast while DynamoDB is
+	// failing.
+	CircuitBreaker *CircuitBreaker
+
+	// Hedging, if set, hedges GetItem and Query against tail latency.
+	Hedging *Hedging
+
+	// Metrics, if set, receives latency, retry and capacity measurements,
+	// per table. The client asks for the ConsumedCapacity of requests
+	// that leave ReturnConsumedCapacity unset, to measure it.
+	Metrics Metrics
+
+	// Middleware runs around every attempt; see Use.
+	Middleware []Middleware
+
+	// Logger receives the client's diagnostics; nil means they are
+	// discarded.
+	Logger *slog.Logger
+}
+
+func (c Config) withDefaults() Config {
+	if c.Region == "" {
+		c.Region = DefaultRegion
+	}
+	if i := strings.Index(c.Endpoint, "://"); i >= 0 {
+		if c.Scheme == "" {
+			c.Scheme = c.Endpoint[:i]
+		}
+		c.Endpoint = c.Endpoint[i+3:]
+	}
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	if c.Endpoint == "" {
+		c.Endpoint = "dynamodb." + c.Region + ".amazonaws.com"
+	}
+	if c.Scheme == "" {
+		c.Scheme = "https"
+	}
+	if c.HTTPClient == nil {
+		transport := c.Transport
+		if transport == nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.MaxIdleConnsPerHost = 100
+			transport = t
+		}
+		c.HTTPClient = &http.Client{Transport: transport}
+	}
+	if c.Credentials == nil {
+		c.Credentials = DefaultCredentials()
+	}
+	if c.Logger == nil {
+		c.Logger = slog.New(slog.DiscardHandler)
+	}
+	return c
+}
+
+func (c Config) url() string {
+	return c.Scheme + "://" + c.Endpoint + "/"
+}
@@ -0,0 +1,187 @@
+package dynamodb
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials sign requests. SessionToken is only set for temporary
+// credentials, which also carry their expiry.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // zero if the credentials do not expire
+}
+
+// CredentialsProvider supplies the credentials for each request.
+// Implementations must be safe for concurrent use.
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// ErrNoCredentials is returned by providers that found no credentials.
+var ErrNoCredentials = errors.New("dynamodb: no credentials")
+
+// StaticCredentials always provides the same credentials.
+type StaticCredentials Credentials
+
+func (s StaticCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return Credentials(s), nil
+}
+
+// EnvCredentials provides credentials from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, or
+// the older AWS_ACCESS_KEY and AWS_SECRET_KEY.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	c := Credentials{AccessKeyID: os.Getenv("AWS_ACCESS_KEY_ID"), SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"), SessionToken: os.Getenv("AWS_SESSION_TOKEN")}
+	if c.AccessKeyID == "" {
+		c.AccessKeyID = os.Getenv("AWS_ACCESS_KEY")
+	}
+	if c.SecretAccessKey == "" {
+		c.SecretAccessKey = os.Getenv("AWS_SECRET_KEY")
+	}
+	return StaticCredentials(c).Retrieve(ctx)
+}
+
+// SharedCredentialsFile provides credentials from a profile of the INI
+// style file written by the AWS CLI.
+type SharedCredentialsFile struct {
+	// Filename defaults to $AWS_SHARED_CREDENTIALS_FILE, then
+	// ~/.aws/credentials.
+	Filename string
+
+	// Profile defaults to $AWS_PROFILE, then "default".
+	Profile string
+}
+
+func (f *SharedCredentialsFile) Retrieve(ctx context.Context) (Credentials, error) {
+	filename := f.Filename
+	if filename == "" {
+		filename = os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	}
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, ErrNoCredentials
+		}
+		filename = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := f.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return Credentials{}, ErrNoCredentials
+	} else if err != nil {
+		return Credentials{}, err
+	}
+	defer file.Close()
+
+	var c Credentials
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		case section == profile:
+			if i := strings.Index(line, "="); i > 0 {
+				value := strings.TrimSpace(line[i+1:])
+				switch strings.ToLower(strings.TrimSpace(line[:i])) {
+				case "aws_access_key_id":
+					c.AccessKeyID = value
+				case "aws_secret_access_key":
+					c.SecretAccessKey = value
+				case "aws_session_token":
+					c.SessionToken = value
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, err
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("%w in profile %q of %s", ErrNoCredentials, profile, filename)
+	}
+	return c, nil
+}
+
+// CredentialsChain provides the credentials of the first of its providers
+// that has any.
+type CredentialsChain []CredentialsProvider
+
+func (chain CredentialsChain) Retrieve(ctx context.Context) (Credentials, error) {
+	for _, p := range chain {
+		c, err := p.Retrieve(ctx)
+		if err == nil {
+			return c, nil
+		}
+		if !errors.Is(err, ErrNoCredentials) {
+			return Credentials{}, err
+		}
+	}
+	return Credentials{}, ErrNoCredentials
+}
+
+// RefreshingCredentials caches the credentials of Provider, retrieving
+// them again once they are within ExpiryWindow of expiring.
+type RefreshingCredentials struct {
+	Provider     CredentialsProvider
+	ExpiryWindow time.Duration
+
+	mu     sync.Mutex
+	cached *Credentials
+}
+
+// NewRefreshingCredentials returns a cache of provider's credentials.
+func NewRefreshingCredentials(provider CredentialsProvider, expiryWindow time.Duration) *RefreshingCredentials {
+	return &RefreshingCredentials{Provider: provider, ExpiryWindow: expiryWindow}
+}
+
+func (r *RefreshingCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cached != nil && (r.cached.Expires.IsZero() || time.Now().Add(r.ExpiryWindow).Before(r.cached.Expires)) {
+		return *r.cached, nil
+	}
+	c, err := r.Provider.Retrieve(ctx)
+	if err != nil {
+		return Credentials{}, err
+	}
+	r.cached = &c
+	return c, nil
+}
+
+// Expire forces the next Retrieve to ask Provider again.
+func (r *RefreshingCredentials) Expire() {
+	r.mu.Lock()
+	r.cached = nil
+	r.mu.Unlock()
+}
+
+// DefaultCredentials returns the provider used when a Config has none: the
+// environment, then the shared credentials file.
+func DefaultCredentials() CredentialsProvider {
+	return NewRefreshingCredentials(CredentialsChain{EnvCredentials{}, &SharedCredentialsFile{}}, time.Minute)
+}
@@ -2,14 +2,16 @@ package dynamodb
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
-	"log"
-	"math"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/eikeon/aws4"
@@ -17,94 +19,325 @@ import (
 
 type dynamo struct {
 	mapping
-	client *aws4.Client
+	config  Config
+	service *aws4.Service
+	handler Handler
 }
 
+// NewDynamoDB returns a client for DefaultRegion using DefaultCredentials,
+// or nil if there are none.
+//
+// Deprecated: use NewDynamoDBWithConfig, which reports why.
 func NewDynamoDB() DynamoDB {
-	d := &dynamo{mapping: make(mapping)}
-	if d.getClient() == nil {
-		log.Println("could not create dynamodb: no default aws4 client")
+	d, err := NewDynamoDBWithConfig(Config{})
+	if err != nil {
 		return nil
 	}
 	return d
 }
 
-func (b *dynamo) getClient() *aws4.Client {
-	if b.client == nil {
-		b.client = aws4.DefaultClient
-		if b.client != nil {
-			tr := &http.Transport{DisableKeepAlives: false, MaxIdleConnsPerHost: 100}
-			c := &http.Client{Transport: tr}
-			b.client.Client = c
-		}
+// NewDynamoDBWithConfig returns a client for the region and endpoint
+// described by config. It fails if config's credentials cannot be
+// retrieved.
+func NewDynamoDBWithConfig(config Config) (DynamoDB, error) {
+	config = config.withDefaults()
+	if _, err := config.Credentials.Retrieve(context.Background()); err != nil {
+		return nil, fmt.Errorf("could not create dynamodb: %w", err)
 	}
-	return b.client
+	d := &dynamo{mapping: newMapping(config.Logger), config: config, service: &aws4.Service{Name: "dynamodb", Region: config.Region}}
+	d.handler = chain(d.do, config.Middleware)
+	return d, nil
 }
 
-func (db *dynamo) post(action string, parameters interface{}) (io.ReadCloser, error) {
-	url := "https://dynamodb.us-east-1.amazonaws.com/"
-	currentRetry := 0
-	maxNumberOfRetries := 10
-RETRY:
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	if err := enc.Encode(parameters); err != nil {
-		return nil, err
+func (db *dynamo) retryPolicy() RetryPolicy {
+	if db.config.RetryPolicy != nil {
+		return db.config.RetryPolicy
 	}
-	if request, err := http.NewRequest("POST", url, &buf); err != nil {
+	return DefaultRetryPolicy
+}
+
+// consumesCapacity is the set of single table actions that report
+// ConsumedCapacity and so are subject to the rate limiter.
+var consumesCapacity = map[string]bool{"DeleteItem": true, "GetItem": true, "PutItem": true, "Query": true, "Scan": true, "UpdateItem": true}
+
+// reportsCapacity is the set of actions that can report ConsumedCapacity,
+// including those on several tables.
+var reportsCapacity = map[string]bool{"BatchGetItem": true, "BatchWriteItem": true, "DeleteItem": true, "GetItem": true, "PutItem": true, "Query": true, "Scan": true, "TransactGetItems": true, "TransactWriteItems": true, "UpdateItem": true}
+
+// readActions is the set of actions whose consumed capacity is read
+// capacity.
+var readActions = map[string]bool{"BatchGetItem": true, "GetItem": true, "Query": true, "Scan": true, "TransactGetItems": true}
+
+// post sends action to DynamoDB, retrying as the retry policy allows.
+// tableName is the table the action addresses, or "" for batch actions.
+func (db *dynamo) post(ctx context.Context, action, tableName string, parameters interface{}) (io.ReadCloser, error) {
+	body, err := json.Marshal(parameters)
+	if err != nil {
 		return nil, err
-	} else {
-		request.Header.Set("Content-Type", "application/x-amz-json-1.0")
-		request.Header.Set("X-Amz-Target", "DynamoDB_20120810"+"."+action)
-
-		if response, err := db.getClient().Do(request); err == nil {
-			switch response.StatusCode {
-			case 200:
-				return response.Body, nil
-			case 400:
-				type ResponseError struct {
-					StatusCode int
-					Type       string `json:"__type"`
-					Message    string
-				}
-				var error ResponseError
-				if err = json.NewDecoder(response.Body).Decode(&error); err != nil {
-					return nil, err
-				}
-				response.Body.Close()
-				if error.Type == "com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException" {
-					log.Println("Provisioned throughput exceeded... retrying:", action)
+	}
+	// The rate limiter and metrics learn from ConsumedCapacity, so ask
+	// for it, and hide it again from callers who did not.
+	injected := false
+	if (db.config.RateLimiter != nil && consumesCapacity[action]) || (db.config.Metrics != nil && reportsCapacity[action]) {
+		if body, injected, err = requestConsumedCapacity(body); err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	response, err := db.attempt(ctx, action, tableName, body)
+	if metrics := db.config.Metrics; metrics != nil {
+		for _, table := range requestTables(tableName, body) {
+			metrics.Request(action, table, time.Since(start), err)
+		}
+		if err == nil {
+			for _, c := range consumedCapacity(response) {
+				if readActions[action] {
+					metrics.Capacity(action, c.TableName, c.CapacityUnits, 0)
 				} else {
-					return nil, errors.New(fmt.Sprintf("%#v", error))
-				}
-			case 500:
-				response.Body.Close()
-				log.Println("Got a 500 error... retrying.")
-			default:
-				b, err := ioutil.ReadAll(response.Body)
-				response.Body.Close()
-				if err != nil {
-					return nil, err
+					metrics.Capacity(action, c.TableName, 0, c.CapacityUnits)
 				}
-				return nil, errors.New(string(b))
 			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if injected {
+		response = withoutConsumedCapacity(response)
+	}
+	return ioutil.NopCloser(bytes.NewReader(response)), nil
+}
+
+// requestTables returns the tables a request addresses: tableName, or for
+// batch and transaction actions the tables named in body, or else "".
+func requestTables(tableName string, body []byte) []string {
+	if tableName != "" {
+		return []string{tableName}
+	}
+	var request struct {
+		RequestItems  map[string]json.RawMessage
+		TransactItems []map[string]struct{ TableName string }
+	}
+	json.Unmarshal(body, &request)
+	tables := make(map[string]bool)
+	for table := range request.RequestItems {
+		tables[table] = true
+	}
+	for _, item := range request.TransactItems {
+		for _, action := range item {
+			tables[action.TableName] = true
+		}
+	}
+	if len(tables) == 0 {
+		return []string{""}
+	}
+	return sortedNames(tables)
+}
+
+// requestConsumedCapacity adds ReturnConsumedCapacity TOTAL to the request
+// body unless it already has a ReturnConsumedCapacity, reporting whether it
+// did.
+func requestConsumedCapacity(body []byte) ([]byte, bool, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false, err
+	}
+	if _, ok := fields["ReturnConsumedCapacity"]; ok {
+		return body, false, nil
+	}
+	fields["ReturnConsumedCapacity"] = json.RawMessage(`"TOTAL"`)
+	body, err := json.Marshal(fields)
+	return body, err == nil, err
+}
+
+// withoutConsumedCapacity removes ConsumedCapacity from a response body.
+func withoutConsumedCapacity(body []byte) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	if _, ok := fields["ConsumedCapacity"]; !ok {
+		return body
+	}
+	delete(fields, "ConsumedCapacity")
+	if b, err := json.Marshal(fields); err == nil {
+		return b
+	}
+	return body
+}
+
+// attempt sends body until it succeeds or the retry policy gives up.
+func (db *dynamo) attempt(ctx context.Context, action, tableName string, body []byte) ([]byte, error) {
+	limiter := db.config.RateLimiter
+	if !consumesCapacity[action] {
+		limiter = nil
+	}
+	breaker, circuit := db.config.CircuitBreaker, db.config.Endpoint
+	if breaker != nil && breaker.PerTable && tableName != "" {
+		circuit = tableName
+	}
+	start := time.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		if limiter != nil {
+			if err := limiter.Wait(ctx, tableName); err != nil {
+				return nil, err
+			}
+		}
+		if breaker != nil {
+			if err := breaker.Allow(circuit); err != nil {
+				return nil, err
+			}
+		}
+		var response []byte
+		var err error
+		if h := db.config.Hedging; h != nil && hedgedActions[action] {
+			response, err = db.hedge(ctx, h, action, tableName, attempt, body)
 		} else {
+			response, err = db.send(ctx, action, tableName, attempt, body)
+		}
+		if breaker != nil {
+			breaker.Record(circuit, err)
+		}
+		if err == nil {
+			if limiter != nil {
+				consumed := consumedCapacity(response)
+				if consumed == nil {
+					consumed = []ConsumedCapacity{{TableName: tableName, CapacityUnits: 1}}
+				}
+				for _, c := range consumed {
+					limiter.Consumed(c.TableName, c.CapacityUnits)
+				}
+			}
+			return response, nil
+		}
+		if limiter != nil && IsThrottle(err) {
+			limiter.Throttled(tableName)
+		}
+		var retry bool
+		if delay, retry = db.retryPolicy().Retry(attempt, time.Since(start), delay, err); !retry {
+			db.config.Logger.LogAttrs(ctx, slog.LevelDebug, "request failed", slog.String("operation", action), slog.String("table", tableName), slog.Int("attempt", attempt), slog.Any("error", err))
+			if attempt > 1 {
+				return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
 			return nil, err
 		}
-		if currentRetry < maxNumberOfRetries {
-			wait := time.Duration(math.Pow(2, float64(currentRetry))) * 50 * time.Millisecond
-			time.Sleep(wait)
-			currentRetry = currentRetry + 1
-			goto RETRY
-		} else {
-			return nil, errors.New("exceeded maximum number of retries")
+		if db.config.Metrics != nil {
+			for _, table := range requestTables(tableName, body) {
+				db.config.Metrics.Retry(action, table, err)
+			}
 		}
+		db.config.Logger.LogAttrs(ctx, slog.LevelInfo, "retrying", slog.String("operation", action), slog.String("table", tableName), slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.Any("error", err))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send makes a single attempt at action, returning the response body.
+func (db *dynamo) send(ctx context.Context, action, tableName string, attempt int, body []byte) ([]byte, error) {
+	attemptCtx := ctx
+	if db.config.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, db.config.AttemptTimeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(attemptCtx, "POST", db.config.url(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	request.Header.Set("X-Amz-Target", "DynamoDB_20120810"+"."+action)
+
+	r := &Request{Operation: action, TableName: tableName, Attempt: attempt, Parameters: body, HTTPRequest: request}
+	if err := db.handler(r); err != nil {
+		if ctx.Err() == nil && attemptCtx.Err() != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAttemptTimeout, err)
+		}
+		return nil, err
+	}
+	return r.ResponseBody, nil
+}
+
+// do is the innermost Handler: it signs and sends r.HTTPRequest.
+func (db *dynamo) do(r *Request) error {
+	if r.HTTPRequest.Header.Get("Authorization") == "" {
+		if err := db.sign(r.HTTPRequest); err != nil {
+			return err
+		}
+	}
+	response, err := db.config.HTTPClient.Do(r.HTTPRequest)
+	if err != nil {
+		return err
+	}
+	r.HTTPResponse = response
+	r.ResponseBody, err = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != 200 {
+		return newAPIError(response, r.ResponseBody)
+	}
+	return checkCRC32(response, r.ResponseBody)
+}
+
+// sign adds a signature made with the current credentials to request.
+func (db *dynamo) sign(request *http.Request) error {
+	c, err := db.config.Credentials.Retrieve(request.Context())
+	if err != nil {
+		return err
+	}
+	if c.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+	return db.service.Sign(&aws4.Keys{AccessKey: c.AccessKeyID, SecretKey: c.SecretAccessKey}, request)
+}
+
+// checkCRC32 verifies body against the X-Amz-Crc32 header of response.
+// Bodies the transport has transparently decompressed cannot be checked, as
+// the checksum covers the bytes on the wire.
+func checkCRC32(response *http.Response, body []byte) error {
+	header := response.Header.Get("X-Amz-Crc32")
+	if header == "" || response.Uncompressed {
+		return nil
+	}
+	expected, err := strconv.ParseUint(header, 10, 32)
+	if err != nil || uint32(expected) != crc32.ChecksumIEEE(body) {
+		return ErrCRC32Mismatch
+	}
+	return nil
+}
 
+// consumedCapacity returns the ConsumedCapacity reported in a response
+// body, which is a list for batch actions and a single value otherwise.
+func consumedCapacity(body []byte) []ConsumedCapacity {
+	var response struct {
+		ConsumedCapacity json.RawMessage
+	}
+	if json.Unmarshal(body, &response) != nil || len(response.ConsumedCapacity) == 0 {
+		return nil
 	}
+	var consumed []ConsumedCapacity
+	if response.ConsumedCapacity[0] == '[' {
+		json.Unmarshal(response.ConsumedCapacity, &consumed)
+		return consumed
+	}
+	var c ConsumedCapacity
+	if json.Unmarshal(response.ConsumedCapacity, &c) != nil || c.TableName == "" {
+		return nil
+	}
+	return []ConsumedCapacity{c}
 }
 
 func (db *dynamo) BatchGetItem(requestItems map[string]KeysAndAttributes, options *BatchGetItemOptions) (*BatchGetItemResult, error) {
-	if reader, err := db.post("BatchGetItem", struct {
+	return db.BatchGetItemWithContext(context.Background(), requestItems, options)
+}
+
+func (db *dynamo) BatchGetItemWithContext(ctx context.Context, requestItems map[string]KeysAndAttributes, options *BatchGetItemOptions) (*BatchGetItemResult, error) {
+	if reader, err := db.post(ctx, "BatchGetItem", "", struct {
 		RequestItems map[string]KeysAndAttributes
 		*BatchGetItemOptions
 	}{requestItems, options}); err == nil {
@@ -119,9 +352,13 @@ func (db *dynamo) BatchGetItem(requestItems map[string]KeysAndAttributes, option
 	}
 }
 
-func (db *dynamo) BatchWriteItem(requestItems map[string]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error) {
-	if reader, err := db.post("BatchGetItem", struct {
-		RequestItems map[string]WriteRequest
+func (db *dynamo) BatchWriteItem(requestItems map[string][]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error) {
+	return db.BatchWriteItemWithContext(context.Background(), requestItems, options)
+}
+
+func (db *dynamo) BatchWriteItemWithContext(ctx context.Context, requestItems map[string][]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error) {
+	if reader, err := db.post(ctx, "BatchWriteItem", "", struct {
+		RequestItems map[string][]WriteRequest
 		*BatchWriteItemOptions
 	}{requestItems, options}); err == nil {
 		response := &BatchWriteItemResult{}
@@ -136,6 +373,10 @@ func (db *dynamo) BatchWriteItem(requestItems map[string]WriteRequest, options *
 }
 
 func (db *dynamo) CreateTable(tableName string, attributeDefinitions []AttributeDefinition, keySchema []KeySchemaElement, provisionedThroughput ProvisionedThroughput, options *CreateTableOptions) (*CreateTableResult, error) {
+	return db.CreateTableWithContext(context.Background(), tableName, attributeDefinitions, keySchema, provisionedThroughput, options)
+}
+
+func (db *dynamo) CreateTableWithContext(ctx context.Context, tableName string, attributeDefinitions []AttributeDefinition, keySchema []KeySchemaElement, provisionedThroughput ProvisionedThroughput, options *CreateTableOptions) (*CreateTableResult, error) {
 	table := struct {
 		TableName             string
 		AttributeDefinitions  []AttributeDefinition
@@ -143,7 +384,7 @@ func (db *dynamo) CreateTable(tableName string, attributeDefinitions []Attribute
 		ProvisionedThroughput ProvisionedThroughput
 		*CreateTableOptions
 	}{TableName: tableName, AttributeDefinitions: attributeDefinitions, KeySchema: keySchema, ProvisionedThroughput: provisionedThroughput, CreateTableOptions: options}
-	reader, err := db.post("CreateTable", table)
+	reader, err := db.post(ctx, "CreateTable", tableName, table)
 	if err != nil {
 		return nil, err
 	}
@@ -158,7 +399,11 @@ func (db *dynamo) CreateTable(tableName string, attributeDefinitions []Attribute
 }
 
 func (db *dynamo) UpdateItem(tableName string, key Key, options *UpdateItemOptions) (*UpdateItemResult, error) {
-	if reader, err := db.post("BatchGetItem", struct {
+	return db.UpdateItemWithContext(context.Background(), tableName, key, options)
+}
+
+func (db *dynamo) UpdateItemWithContext(ctx context.Context, tableName string, key Key, options *UpdateItemOptions) (*UpdateItemResult, error) {
+	if reader, err := db.post(ctx, "UpdateItem", tableName, struct {
 		TableName string
 		Key       Key
 		*UpdateItemOptions
@@ -175,9 +420,13 @@ func (db *dynamo) UpdateItem(tableName string, key Key, options *UpdateItemOptio
 }
 
 func (db *dynamo) UpdateTable(tableName string, provisionedThroughput ProvisionedThroughput, options *UpdateTableOptions) (*UpdateTableResult, error) {
-	if reader, err := db.post("UpdateTable", struct {
+	return db.UpdateTableWithContext(context.Background(), tableName, provisionedThroughput, options)
+}
+
+func (db *dynamo) UpdateTableWithContext(ctx context.Context, tableName string, provisionedThroughput ProvisionedThroughput, options *UpdateTableOptions) (*UpdateTableResult, error) {
+	if reader, err := db.post(ctx, "UpdateTable", tableName, struct {
 		TableName             string
-		ProvisionedThroughput ProvisionedThroughput
+		ProvisionedThroughput ProvisionedThroughput `json:",omitzero"`
 		*UpdateTableOptions
 	}{tableName, provisionedThroughput, options}); err == nil {
 		response := &UpdateTableResult{}
@@ -192,7 +441,11 @@ func (db *dynamo) UpdateTable(tableName string, provisionedThroughput Provisione
 }
 
 func (db *dynamo) DescribeTable(tableName string, options *DescribeTableOptions) (*DescribeTableResult, error) {
-	reader, err := db.post("DescribeTable", struct {
+	return db.DescribeTableWithContext(context.Background(), tableName, options)
+}
+
+func (db *dynamo) DescribeTableWithContext(ctx context.Context, tableName string, options *DescribeTableOptions) (*DescribeTableResult, error) {
+	reader, err := db.post(ctx, "DescribeTable", tableName, struct {
 		TableName string
 		*DescribeTableOptions
 	}{tableName, options})
@@ -210,7 +463,11 @@ func (db *dynamo) DescribeTable(tableName string, options *DescribeTableOptions)
 }
 
 func (db *dynamo) DeleteTable(tableName string, options *DeleteTableOptions) (*DeleteTableResult, error) {
-	if reader, err := db.post("DeleteTable", struct {
+	return db.DeleteTableWithContext(context.Background(), tableName, options)
+}
+
+func (db *dynamo) DeleteTableWithContext(ctx context.Context, tableName string, options *DeleteTableOptions) (*DeleteTableResult, error) {
+	if reader, err := db.post(ctx, "DeleteTable", tableName, struct {
 		TableName string
 		*DeleteTableOptions
 	}{tableName, options}); err == nil {
@@ -226,7 +483,11 @@ func (db *dynamo) DeleteTable(tableName string, options *DeleteTableOptions) (*D
 }
 
 func (db *dynamo) PutItem(tableName string, item Item, options *PutItemOptions) (*PutItemResult, error) {
-	if reader, err := db.post("PutItem", struct {
+	return db.PutItemWithContext(context.Background(), tableName, item, options)
+}
+
+func (db *dynamo) PutItemWithContext(ctx context.Context, tableName string, item Item, options *PutItemOptions) (*PutItemResult, error) {
+	if reader, err := db.post(ctx, "PutItem", tableName, struct {
 		TableName string
 		Item      Item
 		*PutItemOptions
@@ -243,7 +504,11 @@ func (db *dynamo) PutItem(tableName string, item Item, options *PutItemOptions)
 }
 
 func (db *dynamo) DeleteItem(tableName string, key Key, options *DeleteItemOptions) (*DeleteItemResult, error) {
-	if reader, err := db.post("DeleteItem", struct {
+	return db.DeleteItemWithContext(context.Background(), tableName, key, options)
+}
+
+func (db *dynamo) DeleteItemWithContext(ctx context.Context, tableName string, key Key, options *DeleteItemOptions) (*DeleteItemResult, error) {
+	if reader, err := db.post(ctx, "DeleteItem", tableName, struct {
 		TableName string
 		Key       Key
 		*DeleteItemOptions
@@ -260,7 +525,11 @@ func (db *dynamo) DeleteItem(tableName string, key Key, options *DeleteItemOptio
 }
 
 func (db *dynamo) GetItem(tableName string, key Key, options *GetItemOptions) (*GetItemResult, error) {
-	reader, err := db.post("GetItem", struct {
+	return db.GetItemWithContext(context.Background(), tableName, key, options)
+}
+
+func (db *dynamo) GetItemWithContext(ctx context.Context, tableName string, key Key, options *GetItemOptions) (*GetItemResult, error) {
+	reader, err := db.post(ctx, "GetItem", tableName, struct {
 		TableName string
 		Key       Key
 		*GetItemOptions
@@ -281,11 +550,30 @@ func (db *dynamo) GetItem(tableName string, key Key, options *GetItemOptions) (*
 }
 
 func (db *dynamo) ListTables(options *ListTablesOptions) (*ListTablesResult, error) {
-	return nil, errors.New("NYI")
+	return db.ListTablesWithContext(context.Background(), options)
+}
+
+func (db *dynamo) ListTablesWithContext(ctx context.Context, options *ListTablesOptions) (*ListTablesResult, error) {
+	reader, err := db.post(ctx, "ListTables", "", struct {
+		*ListTablesOptions
+	}{options})
+	if err != nil {
+		return nil, err
+	}
+	response := &ListTablesResult{}
+	if err = json.NewDecoder(reader).Decode(&response); err != nil {
+		return nil, err
+	}
+	reader.Close()
+	return response, nil
 }
 
 func (db *dynamo) Scan(tableName string, options *ScanOptions) (*ScanResult, error) {
-	reader, err := db.post("Scan", struct {
+	return db.ScanWithContext(context.Background(), tableName, options)
+}
+
+func (db *dynamo) ScanWithContext(ctx context.Context, tableName string, options *ScanOptions) (*ScanResult, error) {
+	reader, err := db.post(ctx, "Scan", tableName, struct {
 		TableName string
 		*ScanOptions
 	}{tableName, options})
@@ -303,11 +591,15 @@ func (db *dynamo) Scan(tableName string, options *ScanOptions) (*ScanResult, err
 }
 
 func (db *dynamo) Query(tableName string, options *QueryOptions) (*QueryResult, error) {
+	return db.QueryWithContext(context.Background(), tableName, options)
+}
+
+func (db *dynamo) QueryWithContext(ctx context.Context, tableName string, options *QueryOptions) (*QueryResult, error) {
 	query := struct {
 		TableName string
 		*QueryOptions
 	}{TableName: tableName, QueryOptions: options}
-	reader, err := db.post("Query", query)
+	reader, err := db.post(ctx, "Query", tableName, query)
 	if err != nil {
 		return nil, err
 	}
@@ -320,3 +612,61 @@ func (db *dynamo) Query(tableName string, options *QueryOptions) (*QueryResult,
 	}
 	return response, nil
 }
+
+func (db *dynamo) TransactGetItems(transactItems []TransactGetItem, options *TransactGetItemsOptions) (*TransactGetItemsResult, error) {
+	return db.TransactGetItemsWithContext(context.Background(), transactItems, options)
+}
+
+func (db *dynamo) TransactGetItemsWithContext(ctx context.Context, transactItems []TransactGetItem, options *TransactGetItemsOptions) (*TransactGetItemsResult, error) {
+	reader, err := db.post(ctx, "TransactGetItems", "", struct {
+		TransactItems []TransactGetItem
+		*TransactGetItemsOptions
+	}{transactItems, options})
+	if err != nil {
+		return nil, err
+	}
+	response := &TransactGetItemsResult{}
+	if err = json.NewDecoder(reader).Decode(&response); err != nil {
+		return nil, err
+	}
+	reader.Close()
+	return response, nil
+}
+
+func (db *dynamo) TransactWriteItems(transactItems []TransactWriteItem, options *TransactWriteItemsOptions) (*TransactWriteItemsResult, error) {
+	return db.TransactWriteItemsWithContext(context.Background(), transactItems, options)
+}
+
+func (db *dynamo) TransactWriteItemsWithContext(ctx context.Context, transactItems []TransactWriteItem, options *TransactWriteItemsOptions) (*TransactWriteItemsResult, error) {
+	// Every attempt must carry the same token, so that DynamoDB applies a
+	// retried transaction only once.
+	o := TransactWriteItemsOptions{}
+	if options != nil {
+		o = *options
+	}
+	if o.ClientRequestToken == "" {
+		o.ClientRequestToken = clientRequestToken()
+	}
+	reader, err := db.post(ctx, "TransactWriteItems", "", struct {
+		TransactItems []TransactWriteItem
+		*TransactWriteItemsOptions
+	}{transactItems, &o})
+	if err != nil {
+		return nil, err
+	}
+	response := &TransactWriteItemsResult{}
+	if err = json.NewDecoder(reader).Decode(&response); err != nil {
+		return nil, err
+	}
+	reader.Close()
+	return response, nil
+}
+
+// clientRequestToken returns a random version 4 UUID.
+func clientRequestToken() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
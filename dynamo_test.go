@@ -0,0 +1,374 @@
+package dynamodb_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eikeon/dynamodb"
+)
+
+// fakeEndpoint records the last request it received and answers every
+// request with response.
+type fakeEndpoint struct {
+	*httptest.Server
+	target   string
+	body     []byte
+	response string
+}
+
+func newFakeEndpoint(t *testing.T) (*fakeEndpoint, dynamodb.DynamoDB) {
+	f := &fakeEndpoint{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/" {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-amz-json-1.0" {
+			t.Errorf("unexpected Content-Type %q", ct)
+		}
+		if r.Header.Get("Authorization") == "" {
+			t.Error("request was not signed")
+		}
+		f.target = r.Header.Get("X-Amz-Target")
+		f.body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte(f.response))
+	}))
+	db, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Endpoint: f.URL, Credentials: dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, db
+}
+
+// newTestDB starts a server for handler, closed when the test ends, and
+// returns a client for it that retries up to three attempts a millisecond
+// apart. configure, if not nil, adjusts the Config first.
+func newTestDB(t *testing.T, handler http.HandlerFunc, configure func(*dynamodb.Config)) dynamodb.DynamoDB {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	config := dynamodb.Config{Endpoint: server.URL, Credentials: dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret"}}
+	config.RetryPolicy = &dynamodb.BackoffRetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	if configure != nil {
+		configure(&config)
+	}
+	db, err := dynamodb.NewDynamoDBWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestWireConformance(t *testing.T) {
+	f, db := newFakeEndpoint(t)
+	defer f.Close()
+
+	key := dynamodb.Key{"Host": dynamodb.StringValue("example.com")}
+	item := dynamodb.Item{"Host": dynamodb.StringValue("example.com"), "Count": dynamodb.NumberValue("1")}
+	pt := dynamodb.ProvisionedThroughput{ReadCapacityUnits: 5, WriteCapacityUnits: 10}
+
+	cases := []struct {
+		action   string
+		call     func() (interface{}, error)
+		request  string
+		response string
+		check    func(result interface{}) bool
+	}{
+		{
+			"BatchGetItem",
+			func() (interface{}, error) {
+				return db.BatchGetItem(map[string]dynamodb.KeysAndAttributes{"T": {Keys: []dynamodb.Key{key}, ConsistentRead: true, AttributesToGet: []string{"Host"}}}, &dynamodb.BatchGetItemOptions{ReturnConsumedCapacity: "TOTAL"})
+			},
+			`{"RequestItems":{"T":{"Keys":[{"Host":{"S":"example.com"}}],"ConsistentRead":true,"AttributesToGet":["Host"]}},"ReturnConsumedCapacity":"TOTAL"}`,
+			`{"Responses":{"T":[{"Host":{"S":"example.com"}}]},"UnprocessedKeys":{"T":{"Keys":[{"Host":{"S":"other.com"}}],"ConsistentRead":true}},"ConsumedCapacity":[{"TableName":"T","CapacityUnits":1}]}`,
+			func(r interface{}) bool {
+				b := r.(*dynamodb.BatchGetItemResult)
+				return b.Responses["T"][0]["Host"].Equal(dynamodb.StringValue("example.com")) && b.UnprocessedKeys["T"].Keys[0]["Host"].Equal(dynamodb.StringValue("other.com")) && b.UnprocessedKeys["T"].ConsistentRead && b.ConsumedCapacity[0].CapacityUnits == 1
+			},
+		},
+		{
+			"BatchWriteItem",
+			func() (interface{}, error) {
+				return db.BatchWriteItem(map[string][]dynamodb.WriteRequest{"T": {{DeleteRequest: &dynamodb.DeleteRequest{Key: key}}, {PutRequest: &dynamodb.PutRequest{Item: item}}}}, nil)
+			},
+			`{"RequestItems":{"T":[{"DeleteRequest":{"Key":{"Host":{"S":"example.com"}}}},{"PutRequest":{"Item":{"Host":{"S":"example.com"},"Count":{"N":"1"}}}}]}}`,
+			`{"UnprocessedItems":{"T":[{"PutRequest":{"Item":{"Host":{"S":"example.com"}}}}]},"ConsumedCapacity":[{"TableName":"T","CapacityUnits":2}]}`,
+			func(r interface{}) bool {
+				b := r.(*dynamodb.BatchWriteItemResult)
+				return b.UnprocessedItems["T"][0].PutRequest.Item["Host"].Equal(dynamodb.StringValue("example.com")) && b.ConsumedCapacity[0].CapacityUnits == 2
+			},
+		},
+		{
+			"CreateTable",
+			func() (interface{}, error) {
+				return db.CreateTable("T", []dynamodb.AttributeDefinition{{"Host", "S"}}, []dynamodb.KeySchemaElement{{"Host", "HASH"}}, pt, nil)
+			},
+			`{"TableName":"T","AttributeDefinitions":[{"AttributeName":"Host","AttributeType":"S"}],"KeySchema":[{"AttributeName":"Host","KeyType":"HASH"}],"ProvisionedThroughput":{"ReadCapacityUnits":5,"WriteCapacityUnits":10}}`,
+			`{"TableDescription":{"TableName":"T","TableStatus":"CREATING","CreationDateTime":1.36372808007E9}}`,
+			func(r interface{}) bool {
+				td := r.(*dynamodb.CreateTableResult).TableDescription
+				return td.TableStatus == "CREATING" && td.CreationDateTime == 1.36372808007e9
+			},
+		},
+		{
+			"DeleteItem",
+			func() (interface{}, error) {
+				return db.DeleteItem("T", key, &dynamodb.DeleteItemOptions{ReturnValues: "ALL_OLD"})
+			},
+			`{"TableName":"T","Key":{"Host":{"S":"example.com"}},"ReturnValues":"ALL_OLD"}`,
+			`{"Attributes":{"Count":{"N":"1"}}}`,
+			func(r interface{}) bool {
+				return r.(*dynamodb.DeleteItemResult).Attributes["Count"].Equal(dynamodb.NumberValue("1"))
+			},
+		},
+		{
+			"DeleteTable",
+			func() (interface{}, error) { return db.DeleteTable("T", nil) },
+			`{"TableName":"T"}`,
+			`{"TableDescription":{"TableName":"T","TableStatus":"DELETING"}}`,
+			func(r interface{}) bool { return r.(*dynamodb.DeleteTableResult).TableDescription.TableStatus == "DELETING" },
+		},
+		{
+			"DescribeTable",
+			func() (interface{}, error) { return db.DescribeTable("T", nil) },
+			`{"TableName":"T"}`,
+			`{"Table":{"TableName":"T","TableStatus":"ACTIVE","ItemCount":3,"ProvisionedThroughput":{"ReadCapacityUnits":5,"WriteCapacityUnits":10}}}`,
+			func(r interface{}) bool {
+				table := r.(*dynamodb.DescribeTableResult).Table
+				return table.ItemCount == 3 && table.ProvisionedThroughput.WriteCapacityUnits == 10
+			},
+		},
+		{
+			"GetItem",
+			func() (interface{}, error) {
+				consistent := true
+				return db.GetItem("T", key, &dynamodb.GetItemOptions{ConsistentRead: &consistent})
+			},
+			`{"TableName":"T","Key":{"Host":{"S":"example.com"}},"ConsistentRead":true}`,
+			`{"Item":{"Host":{"S":"example.com"},"Count":{"N":"1"}}}`,
+			func(r interface{}) bool {
+				return (*r.(*dynamodb.GetItemResult).Item)["Count"].Equal(dynamodb.NumberValue("1"))
+			},
+		},
+		{
+			"ListTables",
+			func() (interface{}, error) {
+				return db.ListTables(&dynamodb.ListTablesOptions{ExclusiveStartTableName: "A", Limit: 1})
+			},
+			`{"ExclusiveStartTableName":"A","Limit":1}`,
+			`{"LastEvaluatedTableName":"T","TableNames":["T"]}`,
+			func(r interface{}) bool {
+				l := r.(*dynamodb.ListTablesResult)
+				return l.LastEvaluatedTableName == "T" && len(l.TableNames) == 1
+			},
+		},
+		{
+			"PutItem",
+			func() (interface{}, error) { return db.PutItem("T", item, nil) },
+			`{"TableName":"T","Item":{"Host":{"S":"example.com"},"Count":{"N":"1"}}}`,
+			`{"ConsumedCapacity":{"TableName":"T","CapacityUnits":1}}`,
+			func(r interface{}) bool { return r.(*dynamodb.PutItemResult).ConsumedCapacity.CapacityUnits == 1 },
+		},
+		{
+			"Query",
+			func() (interface{}, error) {
+				return db.Query("T", &dynamodb.QueryOptions{KeyConditions: dynamodb.KeyConditions{"Host": {AttributeValueList: []dynamodb.AttributeValue{dynamodb.StringValue("example.com")}, ComparisonOperator: "EQ"}}, Limit: 2})
+			},
+			`{"TableName":"T","KeyConditions":{"Host":{"AttributeValueList":[{"S":"example.com"}],"ComparisonOperator":"EQ"}},"Limit":2}`,
+			`{"Count":1,"Items":[{"Host":{"S":"example.com"}}],"LastEvaluatedKey":{"Host":{"S":"example.com"}}}`,
+			func(r interface{}) bool {
+				q := r.(*dynamodb.QueryResult)
+				return q.Count == 1 && q.LastEvaluatedKey["Host"].Equal(dynamodb.StringValue("example.com"))
+			},
+		},
+		{
+			"Scan",
+			func() (interface{}, error) { return db.Scan("T", &dynamodb.ScanOptions{Segment: 1, TotalSegments: 4}) },
+			`{"TableName":"T","Segment":1,"TotalSegments":4}`,
+			`{"Count":1,"ScannedCount":2,"Items":[{"Host":{"S":"example.com"}}]}`,
+			func(r interface{}) bool {
+				s := r.(*dynamodb.ScanResult)
+				return s.Count == 1 && s.ScannedCount == 2 && len(s.Items) == 1
+			},
+		},
+		{
+			"UpdateItem",
+			func() (interface{}, error) {
+				return db.UpdateItem("T", key, &dynamodb.UpdateItemOptions{AttributeUpdates: map[string]dynamodb.AttributeValueUpdate{"Count": {Action: "ADD", Value: dynamodb.NumberValue("1")}}, ReturnValues: "UPDATED_NEW"})
+			},
+			`{"TableName":"T","Key":{"Host":{"S":"example.com"}},"AttributeUpdates":{"Count":{"Action":"ADD","Value":{"N":"1"}}},"ReturnValues":"UPDATED_NEW"}`,
+			`{"Attributes":{"Count":{"N":"2"}}}`,
+			func(r interface{}) bool {
+				return r.(*dynamodb.UpdateItemResult).Attributes["Count"].Equal(dynamodb.NumberValue("2"))
+			},
+		},
+		{
+			"UpdateItem",
+			func() (interface{}, error) {
+				e, err := dynamodb.ExpressionBuilder{}.
+					WithCondition(dynamodb.AttributeExists(dynamodb.Name("Count"))).
+					WithUpdate(dynamodb.UpdateBuilder{}.Set(dynamodb.Name("Count"), dynamodb.Plus(dynamodb.Name("Count"), dynamodb.Value(dynamodb.IntValue(1))))).
+					Build()
+				if err != nil {
+					return nil, err
+				}
+				return db.UpdateItem("T", key, &dynamodb.UpdateItemOptions{ConditionExpression: e.Condition, UpdateExpression: e.Update, ExpressionAttributeNames: e.Names, ExpressionAttributeValues: e.Values})
+			},
+			`{"TableName":"T","Key":{"Host":{"S":"example.com"}},"ConditionExpression":"attribute_exists(#n0)","UpdateExpression":"SET #n0 = #n0 + :v0","ExpressionAttributeNames":{"#n0":"Count"},"ExpressionAttributeValues":{":v0":{"N":"1"}}}`,
+			`{}`,
+			func(r interface{}) bool { return r.(*dynamodb.UpdateItemResult) != nil },
+		},
+		{
+			"TransactGetItems",
+			func() (interface{}, error) {
+				return db.TransactGetItems([]dynamodb.TransactGetItem{{Get: &dynamodb.Get{TableName: "T", Key: key, ProjectionExpression: "#c", ExpressionAttributeNames: map[string]string{"#c": "Count"}}}, {Get: &dynamodb.Get{TableName: "T", Key: dynamodb.Key{"Host": dynamodb.StringValue("other.com")}}}}, nil)
+			},
+			`{"TransactItems":[{"Get":{"TableName":"T","Key":{"Host":{"S":"example.com"}},"ProjectionExpression":"#c","ExpressionAttributeNames":{"#c":"Count"}}},{"Get":{"TableName":"T","Key":{"Host":{"S":"other.com"}}}}]}`,
+			`{"Responses":[{"Item":{"Count":{"N":"1"}}},{}]}`,
+			func(r interface{}) bool {
+				responses := r.(*dynamodb.TransactGetItemsResult).Responses
+				return len(responses) == 2 && responses[0].Item["Count"].Equal(dynamodb.NumberValue("1")) && responses[1].Item == nil
+			},
+		},
+		{
+			"TransactWriteItems",
+			func() (interface{}, error) {
+				return db.TransactWriteItems([]dynamodb.TransactWriteItem{
+					{ConditionCheck: &dynamodb.ConditionCheck{TableName: "Hosts", Key: key, ConditionExpression: "attribute_exists(Host)"}},
+					{Put: &dynamodb.Put{TableName: "T", Item: item}},
+					{Update: &dynamodb.Update{TableName: "T", Key: key, UpdateExpression: "ADD #c :one", ExpressionAttributeNames: map[string]string{"#c": "Count"}, ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":one": dynamodb.NumberValue("1")}}},
+					{Delete: &dynamodb.Delete{TableName: "T", Key: key, ReturnValuesOnConditionCheckFailure: "ALL_OLD"}},
+				}, &dynamodb.TransactWriteItemsOptions{ClientRequestToken: "token", ReturnConsumedCapacity: "TOTAL"})
+			},
+			`{"TransactItems":[{"ConditionCheck":{"TableName":"Hosts","Key":{"Host":{"S":"example.com"}},"ConditionExpression":"attribute_exists(Host)"}},{"Put":{"TableName":"T","Item":{"Host":{"S":"example.com"},"Count":{"N":"1"}}}},{"Update":{"TableName":"T","Key":{"Host":{"S":"example.com"}},"UpdateExpression":"ADD #c :one","ExpressionAttributeNames":{"#c":"Count"},"ExpressionAttributeValues":{":one":{"N":"1"}}}},{"Delete":{"TableName":"T","Key":{"Host":{"S":"example.com"}},"ReturnValuesOnConditionCheckFailure":"ALL_OLD"}}],"ClientRequestToken":"token","ReturnConsumedCapacity":"TOTAL"}`,
+			`{"ConsumedCapacity":[{"TableName":"T","CapacityUnits":6},{"TableName":"Hosts","CapacityUnits":2}]}`,
+			func(r interface{}) bool {
+				c := r.(*dynamodb.TransactWriteItemsResult).ConsumedCapacity
+				return len(c) == 2 && c[1].TableName == "Hosts" && c[1].CapacityUnits == 2
+			},
+		},
+		{
+			"UpdateTable",
+			func() (interface{}, error) { return db.UpdateTable("T", pt, nil) },
+			`{"TableName":"T","ProvisionedThroughput":{"ReadCapacityUnits":5,"WriteCapacityUnits":10}}`,
+			`{"TableDescription":{"TableName":"T","TableStatus":"UPDATING"}}`,
+			func(r interface{}) bool { return r.(*dynamodb.UpdateTableResult).TableDescription.TableStatus == "UPDATING" },
+		},
+		{
+			"UpdateTable",
+			func() (interface{}, error) {
+				return db.UpdateTable("T", dynamodb.ProvisionedThroughput{}, &dynamodb.UpdateTableOptions{
+					AttributeDefinitions: []dynamodb.AttributeDefinition{{AttributeName: "Owner", AttributeType: "S"}},
+					GlobalSecondaryIndexUpdates: []dynamodb.GlobalSecondaryIndexUpdate{{Create: &dynamodb.CreateGlobalSecondaryIndexAction{
+						IndexName:  "ByOwner",
+						KeySchema:  []dynamodb.KeySchemaElement{{AttributeName: "Owner", KeyType: "HASH"}},
+						Projection: dynamodb.Projection{ProjectionType: "KEYS_ONLY"},
+					}}},
+				})
+			},
+			`{"TableName":"T","AttributeDefinitions":[{"AttributeName":"Owner","AttributeType":"S"}],"GlobalSecondaryIndexUpdates":[{"Create":{"IndexName":"ByOwner","KeySchema":[{"AttributeName":"Owner","KeyType":"HASH"}],"Projection":{"ProjectionType":"KEYS_ONLY"}}}]}`,
+			`{"TableDescription":{"TableName":"T","TableStatus":"UPDATING","GlobalSecondaryIndexes":[{"IndexName":"ByOwner","IndexStatus":"CREATING"}]}}`,
+			func(r interface{}) bool {
+				return r.(*dynamodb.UpdateTableResult).TableDescription.GlobalSecondaryIndexes[0].IndexStatus == "CREATING"
+			},
+		},
+	}
+	for _, c := range cases {
+		f.response = c.response
+		result, err := c.call()
+		if err != nil {
+			t.Errorf("%s: %v", c.action, err)
+			continue
+		}
+		if f.target != "DynamoDB_20120810."+c.action {
+			t.Errorf("%s: posted X-Amz-Target %q", c.action, f.target)
+		}
+		if !jsonEqual(f.body, []byte(c.request)) {
+			t.Errorf("%s: posted\n%s\nwant\n%s", c.action, f.body, c.request)
+		}
+		if !c.check(result) {
+			t.Errorf("%s: decoded %+v from %s", c.action, result, c.response)
+		}
+	}
+}
+
+func TestClientRequestToken(t *testing.T) {
+	f, db := newFakeEndpoint(t)
+	defer f.Close()
+
+	f.response = `{}`
+	put := []dynamodb.TransactWriteItem{{Put: &dynamodb.Put{TableName: "T", Item: dynamodb.Item{"Host": dynamodb.StringValue("example.com")}}}}
+	tokens := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		if _, err := db.TransactWriteItems(put, nil); err != nil {
+			t.Fatal(err)
+		}
+		var request struct{ ClientRequestToken string }
+		if err := json.Unmarshal(f.body, &request); err != nil || len(request.ClientRequestToken) != 36 {
+			t.Fatalf("posted %s", f.body)
+		}
+		tokens[request.ClientRequestToken] = true
+	}
+	if len(tokens) != 2 {
+		t.Errorf("expected a new token for every transaction, got %v", tokens)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	var failing atomic.Bool
+	attempted := make(chan struct{}, 1)
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		select {
+		case attempted <- struct{}{}:
+		default:
+		}
+		if failing.Load() {
+			w.WriteHeader(500)
+			return
+		}
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}, func(c *dynamodb.Config) {
+		c.RetryPolicy = &dynamodb.BackoffRetryPolicy{MaxAttempts: 5, BaseDelay: 5 * time.Second}
+	})
+
+	for _, c := range []struct {
+		name    string
+		failing bool
+	}{{"in flight", false}, {"during backoff", true}} {
+		failing.Store(c.failing)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-attempted
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		start := time.Now()
+		_, err := db.GetItemWithContext(ctx, "T", dynamodb.Key{"Host": dynamodb.StringValue("example.com")}, nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", c.name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: canceling took %v", c.name, elapsed)
+		}
+		cancel()
+	}
+}
@@ -1,6 +1,8 @@
 // A complete client side implementation of the DynamoDB API Version 2012-08-10 along with methods for mapping between items and go values (structs).
 package dynamodb
 
+import "context"
+
 // Represents the date and time when the table was created, in UNIX epoch time format.
 type DateTime float64
 
@@ -9,11 +11,9 @@ type AttributeDefinition struct {
 	AttributeType string
 }
 
-type AttributeValue map[string]string
-
 type AttributeValueUpdate struct {
 	Action string         `json:",omitempty"`
-	Value  AttributeValue `json:",omitempty"`
+	Value  AttributeValue `json:",omitzero"`
 }
 
 type BatchGetItemOptions struct {
@@ -21,7 +21,7 @@ type BatchGetItemOptions struct {
 }
 
 type BatchGetItemResult struct {
-	ConsumedCapacity *ConsumedCapacity
+	ConsumedCapacity []ConsumedCapacity `json:",omitempty"`
 	Responses        map[string][]Item
 	UnprocessedKeys  map[string]KeysAndAttributes
 }
@@ -32,9 +32,17 @@ type BatchWriteItemOptions struct {
 }
 
 type BatchWriteItemResult struct {
-	ConsumedCapacity      *ConsumedCapacity
-	ItemCollectionMetrics *ItemCollectionMetrics
-	UnprocessedKeys       map[string]WriteRequest
+	ConsumedCapacity      []ConsumedCapacity                 `json:",omitempty"`
+	ItemCollectionMetrics map[string][]ItemCollectionMetrics `json:",omitempty"`
+	UnprocessedItems      map[string][]WriteRequest
+}
+
+// CancellationReason is why a transaction cancelled, one per item of the
+// request; Code is "None" for items that were not at fault.
+type CancellationReason struct {
+	Code    string
+	Item    Item   `json:",omitempty"`
+	Message string `json:",omitempty"`
 }
 
 type Condition struct {
@@ -42,30 +50,63 @@ type Condition struct {
 	ComparisonOperator string
 }
 
+type ConditionCheck struct {
+	ConditionExpression                 string
+	ExpressionAttributeNames            map[string]string         `json:",omitempty"`
+	ExpressionAttributeValues           map[string]AttributeValue `json:",omitempty"`
+	Key                                 Key
+	ReturnValuesOnConditionCheckFailure string `json:",omitempty"`
+	TableName                           string
+}
+
 type ConsumedCapacity struct {
 	CapacityUnits float64
 	TableName     string
 }
 
+type CreateGlobalSecondaryIndexAction struct {
+	IndexName             string
+	KeySchema             []KeySchemaElement
+	Projection            Projection
+	ProvisionedThroughput *ProvisionedThroughput `json:",omitempty"`
+}
+
 type CreateTableOptions struct {
-	LocalSecondaryIndexes []LocalSecondaryIndex `json:",omitempty"`
+	GlobalSecondaryIndexes []GlobalSecondaryIndex `json:",omitempty"`
+	LocalSecondaryIndexes  []LocalSecondaryIndex  `json:",omitempty"`
 }
 
 type CreateTableResult struct {
 	TableDescription *TableDescription
 }
 
+type Delete struct {
+	ConditionExpression                 string                    `json:",omitempty"`
+	ExpressionAttributeNames            map[string]string         `json:",omitempty"`
+	ExpressionAttributeValues           map[string]AttributeValue `json:",omitempty"`
+	Key                                 Key
+	ReturnValuesOnConditionCheckFailure string `json:",omitempty"`
+	TableName                           string
+}
+
+type DeleteGlobalSecondaryIndexAction struct {
+	IndexName string
+}
+
 type DeleteItemOptions struct {
+	ConditionExpression         string                            `json:",omitempty"`
 	Expected                    map[string]ExpectedAttributeValue `json:",omitempty"`
+	ExpressionAttributeNames    map[string]string                 `json:",omitempty"`
+	ExpressionAttributeValues   map[string]AttributeValue         `json:",omitempty"`
 	ReturnConsumedCapacity      string                            `json:",omitempty"`
 	ReturnItemCollectionMetrics string                            `json:",omitempty"`
 	ReturnValues                string                            `json:",omitempty"`
 }
 
 type DeleteItemResult struct {
-	Attributes            map[string]AttributeValue
-	ConsumedCapacity      *ConsumedCapacity
-	ItemCollectionMetrics *ItemCollectionMetrics
+	Attributes            map[string]AttributeValue `json:",omitempty"`
+	ConsumedCapacity      *ConsumedCapacity         `json:",omitempty"`
+	ItemCollectionMetrics *ItemCollectionMetrics    `json:",omitempty"`
 }
 
 // There are no options for the DeleteTable action in the API Version 2012-08-10.
@@ -90,28 +131,65 @@ type DescribeTableResult struct {
 
 type ExpectedAttributeValue struct {
 	Exists *bool          `json:",omitempty"`
-	Value  AttributeValue `json:",omitempty"`
+	Value  AttributeValue `json:",omitzero"`
+}
+
+type Get struct {
+	ExpressionAttributeNames map[string]string `json:",omitempty"`
+	Key                      Key
+	ProjectionExpression     string `json:",omitempty"`
+	TableName                string
 }
 
 type GetItemOptions struct {
-	AttributesToGet        *[]string `json:",omitempty"`
-	ConsistentRead         *bool     `json:",omitempty"`
-	ReturnConsumedCapacity string    `json:",omitempty"`
+	AttributesToGet          *[]string         `json:",omitempty"`
+	ConsistentRead           *bool             `json:",omitempty"`
+	ExpressionAttributeNames map[string]string `json:",omitempty"`
+	ProjectionExpression     string            `json:",omitempty"`
+	ReturnConsumedCapacity   string            `json:",omitempty"`
 }
 
 type GetItemResult struct {
-	ConsumedCapacity *ConsumedCapacity
-	Item             *Item
+	ConsumedCapacity *ConsumedCapacity `json:",omitempty"`
+	Item             *Item             `json:",omitempty"`
 }
 
 // +
 type Item map[string]AttributeValue
 
+type GlobalSecondaryIndex struct {
+	IndexName             string
+	KeySchema             []KeySchemaElement
+	Projection            Projection
+	ProvisionedThroughput *ProvisionedThroughput `json:",omitempty"`
+}
+
+type GlobalSecondaryIndexDescription struct {
+	IndexName             string
+	IndexSizeBytes        int64
+	IndexStatus           string
+	ItemCount             int64
+	KeySchema             []KeySchemaElement
+	Projection            *Projection                       `json:",omitempty"`
+	ProvisionedThroughput *ProvisionedThroughputDescription `json:",omitempty"`
+}
+
+// Exactly one of Create, Delete and Update should be set.
+type GlobalSecondaryIndexUpdate struct {
+	Create *CreateGlobalSecondaryIndexAction `json:",omitempty"`
+	Delete *DeleteGlobalSecondaryIndexAction `json:",omitempty"`
+	Update *UpdateGlobalSecondaryIndexAction `json:",omitempty"`
+}
+
 type ItemCollectionMetrics struct {
 	ItemCollectionKey   Key
 	SizeEstimateRangeGB *[]float64
 }
 
+type ItemResponse struct {
+	Item Item `json:",omitempty"`
+}
+
 // +
 type Key map[string]AttributeValue
 
@@ -124,6 +202,11 @@ type KeySchemaElement struct {
 }
 
 type KeysAndAttributes struct {
+	AttributesToGet          []string          `json:",omitempty"`
+	ConsistentRead           bool              `json:",omitempty"`
+	ExpressionAttributeNames map[string]string `json:",omitempty"`
+	Keys                     []Key
+	ProjectionExpression     string `json:",omitempty"`
 }
 
 type ListTablesOptions struct {
@@ -132,7 +215,7 @@ type ListTablesOptions struct {
 }
 
 type ListTablesResult struct {
-	LastEvaluatedTableName string
+	LastEvaluatedTableName string `json:",omitempty"`
 	TableNames             []string
 }
 
@@ -147,7 +230,7 @@ type LocalSecondaryIndexDescription struct {
 	IndexSizeBytes int64
 	ItemCount      int64
 	KeySchema      []KeySchemaElement
-	Projection     *Projection
+	Projection     *Projection `json:",omitempty"`
 }
 
 type Projection struct {
@@ -168,17 +251,29 @@ type ProvisionedThroughputDescription struct {
 	WriteCapacityUnits     int
 }
 
+type Put struct {
+	ConditionExpression                 string                    `json:",omitempty"`
+	ExpressionAttributeNames            map[string]string         `json:",omitempty"`
+	ExpressionAttributeValues           map[string]AttributeValue `json:",omitempty"`
+	Item                                Item
+	ReturnValuesOnConditionCheckFailure string `json:",omitempty"`
+	TableName                           string
+}
+
 type PutItemOptions struct {
+	ConditionExpression         string                            `json:",omitempty"`
 	Expected                    map[string]ExpectedAttributeValue `json:",omitempty"`
+	ExpressionAttributeNames    map[string]string                 `json:",omitempty"`
+	ExpressionAttributeValues   map[string]AttributeValue         `json:",omitempty"`
 	ReturnConsumedCapacity      string                            `json:",omitempty"`
 	ReturnItemCollectionMetrics string                            `json:",omitempty"`
 	ReturnValues                string                            `json:",omitempty"`
 }
 
 type PutItemResult struct {
-	Attributes            map[string]AttributeValue
-	ConsumedCapacity      *ConsumedCapacity
-	ItemCollectionMetrics *ItemCollectionMetrics
+	Attributes            map[string]AttributeValue `json:",omitempty"`
+	ConsumedCapacity      *ConsumedCapacity         `json:",omitempty"`
+	ItemCollectionMetrics *ItemCollectionMetrics    `json:",omitempty"`
 }
 
 type PutRequest struct {
@@ -186,77 +281,144 @@ type PutRequest struct {
 }
 
 type QueryOptions struct {
-	AttributesToGet        []string      `json:",omitempty"`
-	ConsistentRead         bool          `json:",omitempty"`
-	ExclusiveStartKey      Key           `json:",omitempty"`
-	IndexName              string        `json:",omitempty"`
-	KeyConditions          KeyConditions `json:",omitempty"`
-	Limit                  int           `json:",omitempty"`
-	ReturnConsumedCapacity string        `json:",omitempty"`
-	ScanIndexForward       *bool         `json:",omitempty"` // defaults to true
-	Select                 string        `json:",omitempty"`
+	AttributesToGet           []string                  `json:",omitempty"`
+	ConsistentRead            bool                      `json:",omitempty"`
+	ExclusiveStartKey         Key                       `json:",omitempty"`
+	ExpressionAttributeNames  map[string]string         `json:",omitempty"`
+	ExpressionAttributeValues map[string]AttributeValue `json:",omitempty"`
+	FilterExpression          string                    `json:",omitempty"`
+	IndexName                 string                    `json:",omitempty"`
+	KeyConditionExpression    string                    `json:",omitempty"`
+	KeyConditions             KeyConditions             `json:",omitempty"`
+	Limit                     int                       `json:",omitempty"`
+	ProjectionExpression      string                    `json:",omitempty"`
+	ReturnConsumedCapacity    string                    `json:",omitempty"`
+	ScanIndexForward          *bool                     `json:",omitempty"` // defaults to true
+	Select                    string                    `json:",omitempty"`
 }
 
 type QueryResult struct {
-	ConsumedCapacity *ConsumedCapacity
+	ConsumedCapacity *ConsumedCapacity `json:",omitempty"`
 	Count            int
-	Items            []Item
-	LastEvaluatedKey Key
+	Items            []Item `json:",omitempty"`
+	LastEvaluatedKey Key    `json:",omitempty"`
 }
 
 type ScanOptions struct {
-	AttributesToGet        []string      `json:",omitempty"`
-	ExclusiveStartKey      Key           `json:",omitempty"`
-	Limit                  int           `json:",omitempty"`
-	ReturnConsumedCapacity string        `json:",omitempty"`
-	ScanFilter             KeyConditions `json:",omitempty"`
-	Segment                int           `json:",omitempty"`
-	Select                 string        `json:",omitempty"`
-	TotalSegments          int           `json:",omitempty"`
+	AttributesToGet           []string                  `json:",omitempty"`
+	ExclusiveStartKey         Key                       `json:",omitempty"`
+	ExpressionAttributeNames  map[string]string         `json:",omitempty"`
+	ExpressionAttributeValues map[string]AttributeValue `json:",omitempty"`
+	FilterExpression          string                    `json:",omitempty"`
+	Limit                     int                       `json:",omitempty"`
+	ProjectionExpression      string                    `json:",omitempty"`
+	ReturnConsumedCapacity    string                    `json:",omitempty"`
+	ScanFilter                KeyConditions             `json:",omitempty"`
+	Segment                   int                       `json:",omitempty"`
+	Select                    string                    `json:",omitempty"`
+	TotalSegments             int                       `json:",omitempty"`
 }
 
 type ScanResult struct {
-	ConsumedCapacity *ConsumedCapacity
+	ConsumedCapacity *ConsumedCapacity `json:",omitempty"`
 	Count            int
-	Items            []Item
-	LastEvaluatedKey Key
+	Items            []Item `json:",omitempty"`
+	LastEvaluatedKey Key    `json:",omitempty"`
 	ScannedCount     int
 }
 
 type TableDescription struct {
-	AttributeDefinitions  []AttributeDefinition
-	CreationDateTime      DateTime
-	ItemCount             int64
-	KeySchema             []KeySchemaElement
-	LocalSecondaryIndexes []LocalSecondaryIndexDescription
-	ProvisionedThroughput *ProvisionedThroughputDescription
-	TableName             string
-	TableSizeBytes        int64
-	TableStatus           string
+	AttributeDefinitions   []AttributeDefinition `json:",omitempty"`
+	CreationDateTime       DateTime
+	GlobalSecondaryIndexes []GlobalSecondaryIndexDescription `json:",omitempty"`
+	ItemCount              int64
+	KeySchema              []KeySchemaElement
+	LocalSecondaryIndexes  []LocalSecondaryIndexDescription  `json:",omitempty"`
+	ProvisionedThroughput  *ProvisionedThroughputDescription `json:",omitempty"`
+	TableName              string
+	TableSizeBytes         int64
+	TableStatus            string
 }
 
 type UpdateItemOptions struct {
 	AttributeUpdates            map[string]AttributeValueUpdate   `json:",omitempty"`
+	ConditionExpression         string                            `json:",omitempty"`
 	Expected                    map[string]ExpectedAttributeValue `json:",omitempty"`
+	ExpressionAttributeNames    map[string]string                 `json:",omitempty"`
+	ExpressionAttributeValues   map[string]AttributeValue         `json:",omitempty"`
 	ReturnConsumedCapacity      string                            `json:",omitempty"`
 	ReturnItemCollectionMetrics string                            `json:",omitempty"`
 	ReturnValues                string                            `json:",omitempty"`
+	UpdateExpression            string                            `json:",omitempty"`
 }
 
 type UpdateItemResult struct {
-	Attributes            map[string]AttributeValue
-	ConsumedCapacity      *ConsumedCapacity
-	ItemCollectionMetrics *ItemCollectionMetrics
+	Attributes            map[string]AttributeValue `json:",omitempty"`
+	ConsumedCapacity      *ConsumedCapacity         `json:",omitempty"`
+	ItemCollectionMetrics *ItemCollectionMetrics    `json:",omitempty"`
 }
 
-// There are no options for the UpdateTable action in the API Version 2012-08-10.
+// AttributeDefinitions need only name the key attributes of indexes being
+// created. To change only indexes, pass UpdateTable a zero
+// ProvisionedThroughput; it is then left out of the request.
 type UpdateTableOptions struct {
+	AttributeDefinitions        []AttributeDefinition        `json:",omitempty"`
+	GlobalSecondaryIndexUpdates []GlobalSecondaryIndexUpdate `json:",omitempty"`
 }
 
 type UpdateTableResult struct {
 	TableDescription *TableDescription
 }
 
+type TransactGetItem struct {
+	Get *Get
+}
+
+type TransactGetItemsOptions struct {
+	ReturnConsumedCapacity string `json:",omitempty"`
+}
+
+type TransactGetItemsResult struct {
+	ConsumedCapacity []ConsumedCapacity `json:",omitempty"`
+	Responses        []ItemResponse
+}
+
+// Exactly one of ConditionCheck, Delete, Put and Update should be set.
+type TransactWriteItem struct {
+	ConditionCheck *ConditionCheck `json:",omitempty"`
+	Delete         *Delete         `json:",omitempty"`
+	Put            *Put            `json:",omitempty"`
+	Update         *Update         `json:",omitempty"`
+}
+
+// ClientRequestToken makes a request idempotent for ten minutes; the HTTP
+// client generates one if it is empty, so that retries are applied once.
+type TransactWriteItemsOptions struct {
+	ClientRequestToken          string `json:",omitempty"`
+	ReturnConsumedCapacity      string `json:",omitempty"`
+	ReturnItemCollectionMetrics string `json:",omitempty"`
+}
+
+type TransactWriteItemsResult struct {
+	ConsumedCapacity      []ConsumedCapacity                 `json:",omitempty"`
+	ItemCollectionMetrics map[string][]ItemCollectionMetrics `json:",omitempty"`
+}
+
+type Update struct {
+	ConditionExpression                 string                    `json:",omitempty"`
+	ExpressionAttributeNames            map[string]string         `json:",omitempty"`
+	ExpressionAttributeValues           map[string]AttributeValue `json:",omitempty"`
+	Key                                 Key
+	ReturnValuesOnConditionCheckFailure string `json:",omitempty"`
+	TableName                           string
+	UpdateExpression                    string
+}
+
+type UpdateGlobalSecondaryIndexAction struct {
+	IndexName             string
+	ProvisionedThroughput ProvisionedThroughput
+}
+
 type WriteRequest struct {
 	DeleteRequest *DeleteRequest `json:",omitempty"`
 	PutRequest    *PutRequest    `json:",omitempty"`
@@ -266,7 +428,7 @@ type DynamoDB interface {
 	Mapping
 
 	BatchGetItem(requestedItems map[string]KeysAndAttributes, options *BatchGetItemOptions) (*BatchGetItemResult, error)
-	BatchWriteItem(requestedItems map[string]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error)
+	BatchWriteItem(requestedItems map[string][]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error)
 	CreateTable(tableName string, attributeDefinitions []AttributeDefinition, keySchema []KeySchemaElement, ProvisionedThroughput ProvisionedThroughput, options *CreateTableOptions) (*CreateTableResult, error)
 	DeleteItem(tableName string, key Key, options *DeleteItemOptions) (*DeleteItemResult, error)
 	DeleteTable(tableName string, options *DeleteTableOptions) (*DeleteTableResult, error)
@@ -276,6 +438,24 @@ type DynamoDB interface {
 	PutItem(tableName string, item Item, options *PutItemOptions) (*PutItemResult, error)
 	Query(tableName string, options *QueryOptions) (*QueryResult, error)
 	Scan(tableName string, options *ScanOptions) (*ScanResult, error)
+	TransactGetItems(transactItems []TransactGetItem, options *TransactGetItemsOptions) (*TransactGetItemsResult, error)
+	TransactWriteItems(transactItems []TransactWriteItem, options *TransactWriteItemsOptions) (*TransactWriteItemsResult, error)
 	UpdateItem(tableName string, key Key, options *UpdateItemOptions) (*UpdateItemResult, error)
 	UpdateTable(tableName string, provisionedThroughput ProvisionedThroughput, options *UpdateTableOptions) (*UpdateTableResult, error)
+
+	BatchGetItemWithContext(ctx context.Context, requestedItems map[string]KeysAndAttributes, options *BatchGetItemOptions) (*BatchGetItemResult, error)
+	BatchWriteItemWithContext(ctx context.Context, requestedItems map[string][]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error)
+	CreateTableWithContext(ctx context.Context, tableName string, attributeDefinitions []AttributeDefinition, keySchema []KeySchemaElement, ProvisionedThroughput ProvisionedThroughput, options *CreateTableOptions) (*CreateTableResult, error)
+	DeleteItemWithContext(ctx context.Context, tableName string, key Key, options *DeleteItemOptions) (*DeleteItemResult, error)
+	DeleteTableWithContext(ctx context.Context, tableName string, options *DeleteTableOptions) (*DeleteTableResult, error)
+	DescribeTableWithContext(ctx context.Context, tableName string, options *DescribeTableOptions) (*DescribeTableResult, error)
+	GetItemWithContext(ctx context.Context, tableName string, key Key, options *GetItemOptions) (*GetItemResult, error)
+	ListTablesWithContext(ctx context.Context, options *ListTablesOptions) (*ListTablesResult, error)
+	PutItemWithContext(ctx context.Context, tableName string, item Item, options *PutItemOptions) (*PutItemResult, error)
+	QueryWithContext(ctx context.Context, tableName string, options *QueryOptions) (*QueryResult, error)
+	ScanWithContext(ctx context.Context, tableName string, options *ScanOptions) (*ScanResult, error)
+	TransactGetItemsWithContext(ctx context.Context, transactItems []TransactGetItem, options *TransactGetItemsOptions) (*TransactGetItemsResult, error)
+	TransactWriteItemsWithContext(ctx context.Context, transactItems []TransactWriteItem, options *TransactWriteItemsOptions) (*TransactWriteItemsResult, error)
+	UpdateItemWithContext(ctx context.Context, tableName string, key Key, options *UpdateItemOptions) (*UpdateItemResult, error)
+	UpdateTableWithContext(ctx context.Context, tableName string, provisionedThroughput ProvisionedThroughput, options *UpdateTableOptions) (*UpdateTableResult, error)
 }
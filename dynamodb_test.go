@@ -1,11 +1,24 @@
 package dynamodb_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io/ioutil"
 	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -123,6 +136,1203 @@ func testDeleteTable(t *testing.T) {
 
 }
 
+func TestMemoryErrors(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	_, err := db.GetItem("missing", dynamodb.Key{"Host": dynamodb.StringValue("localhost")}, nil)
+	if !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+	var apiErr *dynamodb.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Errorf("expected a 400 *APIError, got %#v", err)
+	}
+	if errors.Is(err, dynamodb.ErrConditionalCheckFailed) {
+		t.Error("ErrResourceNotFound matched ErrConditionalCheckFailed")
+	}
+}
+
+func TestBackoffRetryPolicy(t *testing.T) {
+	p := &dynamodb.BackoffRetryPolicy{MaxAttempts: 3, MaxElapsed: time.Second, BaseDelay: 10 * time.Millisecond, MaxDelay: 40 * time.Millisecond, Jitter: dynamodb.DecorrelatedJitter, Codes: map[string]bool{"ValidationException": true}}
+	throttled := &dynamodb.APIError{Code: "ThrottlingException", StatusCode: 400}
+	if d, ok := p.Retry(1, 0, 0, throttled); !ok || d < 10*time.Millisecond || d > 30*time.Millisecond {
+		t.Errorf("expected a retry within [10ms, 30ms], got %v %v", d, ok)
+	}
+	if _, ok := p.Retry(3, 0, 0, throttled); ok {
+		t.Error("retried past MaxAttempts")
+	}
+	if _, ok := p.Retry(1, time.Second, 0, throttled); ok {
+		t.Error("retried past MaxElapsed")
+	}
+	if _, ok := p.Retry(1, 0, 0, dynamodb.ErrConditionalCheckFailed); ok {
+		t.Error("retried a conditional check failure")
+	}
+	if _, ok := p.Retry(1, 0, 0, dynamodb.ErrValidation); !ok {
+		t.Error("Codes did not override the classification of ValidationException")
+	}
+	if _, ok := p.Retry(1, 0, 0, &dynamodb.APIError{Code: "ServiceUnavailable", StatusCode: 503}); !ok {
+		t.Error("did not retry a 503")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := dynamodb.NewRateLimiter(100, 10, 200)
+	ctx := context.Background()
+	if err := l.Wait(ctx, "T"); err != nil {
+		t.Fatal(err)
+	}
+	l.Consumed("T", 5)
+	l.Throttled("T")
+	l.Throttled("T")
+	stats := l.Stats()["T"]
+	if stats.Requests != 1 || stats.Throttles != 2 || stats.Consumed != 5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.Rate < 25 || stats.Rate > 26 {
+		t.Errorf("expected the rate to be cut to about 25, got %v", stats.Rate)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	waited := 0
+	for waited < 100 {
+		waited++
+		if err := l.Wait(canceled, "T"); err != nil {
+			break
+		}
+	}
+	if waited == 100 {
+		t.Error("Wait never blocked on an empty bucket")
+	}
+	if stats := l.Stats()["T"]; stats.Requests != int64(waited) || stats.Waits != 0 {
+		t.Errorf("a canceled Wait should not be counted: %d waits, stats %+v", waited, stats)
+	}
+
+	var zero dynamodb.RateLimiter
+	for i := 0; i < 3; i++ {
+		if err := zero.Wait(ctx, "T"); err != nil {
+			t.Fatal(err)
+		}
+		zero.Consumed("T", 1)
+	}
+	if stats := zero.Stats()["T"]; stats.Rate <= 25 {
+		t.Errorf("expected the zero RateLimiter to raise its rate from 25, got %+v", stats)
+	}
+	zero.Throttled("T")
+	if stats := zero.Stats()["T"]; stats.Rate < 12 || stats.Rate > 14 {
+		t.Errorf("expected the zero RateLimiter to halve its rate, got %+v", stats)
+	}
+}
+
+func TestRateLimiterConsumedCapacity(t *testing.T) {
+	var requests []string
+	var mu sync.Mutex
+	limiter := dynamodb.NewRateLimiter(100, 10, 200)
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, string(b))
+		mu.Unlock()
+		fmt.Fprint(w, `{"Item":{"Host":{"S":"localhost"}},"ConsumedCapacity":{"TableName":"T","CapacityUnits":3}}`)
+	}, func(c *dynamodb.Config) { c.RateLimiter = limiter })
+	key := dynamodb.Key{"Host": dynamodb.StringValue("localhost")}
+
+	r, err := db.GetItem("T", key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(requests[0], `"ReturnConsumedCapacity":"TOTAL"`) {
+		t.Errorf("expected the limiter to ask for the consumed capacity, posted %s", requests[0])
+	}
+	if r.ConsumedCapacity != nil || r.Item == nil {
+		t.Errorf("expected the unrequested capacity to be left out of %+v", r)
+	}
+	if stats := limiter.Stats()["T"]; stats.Consumed != 3 {
+		t.Errorf("expected the limiter to learn 3 consumed units, got %+v", stats)
+	}
+
+	r, err = db.GetItem("T", key, &dynamodb.GetItemOptions{ReturnConsumedCapacity: "INDEXES"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(requests[1], `"ReturnConsumedCapacity":"INDEXES"`) || r.ConsumedCapacity == nil || r.ConsumedCapacity.CapacityUnits != 3 {
+		t.Errorf("expected the caller's ReturnConsumedCapacity to be kept, posted %s and got %+v", requests[1], r)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen []string
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Trace-Id") != "abc" {
+			t.Error("middleware header was not sent")
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "SignedHeaders=") || !strings.Contains(r.Header.Get("Authorization"), "x-trace-id") {
+			t.Error("middleware header was not signed")
+		}
+		w.WriteHeader(400)
+		fmt.Fprint(w, `{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`)
+	}, func(c *dynamodb.Config) {
+		c.Use(func(next dynamodb.Handler) dynamodb.Handler {
+			return func(r *dynamodb.Request) error {
+				r.HTTPRequest.Header.Set("X-Trace-Id", "abc")
+				err := next(r)
+				seen = append(seen, fmt.Sprintf("%s %s %d %v", r.Operation, r.TableName, r.HTTPResponse.StatusCode, errors.Is(err, dynamodb.ErrConditionalCheckFailed)))
+				return err
+			}
+		})
+	})
+	if _, err := db.PutItem("T", dynamodb.Item{"Host": dynamodb.StringValue("localhost")}, nil); !errors.Is(err, dynamodb.ErrConditionalCheckFailed) {
+		t.Errorf("expected ErrConditionalCheckFailed, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "PutItem T 400 true" {
+		t.Errorf("middleware saw %q", seen)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var requests atomic.Int64
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%2 == 1 {
+			w.WriteHeader(500)
+			fmt.Fprint(w, `{"__type":"com.amazonaws.dynamodb.v20120810#InternalServerError","message":"boom"}`)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}
+	getItem := func(configure func(*dynamodb.Config)) {
+		db := newTestDB(t, handler, configure)
+		if _, err := db.GetItem("T", dynamodb.Key{"Host": dynamodb.StringValue("localhost")}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var defaultOutput bytes.Buffer
+	log.SetOutput(&defaultOutput)
+	getItem(nil)
+	log.SetOutput(os.Stderr)
+	if defaultOutput.Len() != 0 {
+		t.Errorf("expected the client to be silent by default, logged %s", defaultOutput.String())
+	}
+
+	var output bytes.Buffer
+	getItem(func(c *dynamodb.Config) { c.Logger = slog.New(slog.NewJSONHandler(&output, nil)) })
+	var record struct {
+		Level     string
+		Msg       string
+		Operation string
+		Table     string
+		Attempt   int
+		Delay     time.Duration
+		Error     string
+	}
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %s: %v", output.String(), err)
+	}
+	if record.Level != "INFO" || record.Msg != "retrying" || record.Operation != "GetItem" || record.Table != "T" || record.Attempt != 1 || record.Delay <= 0 || !strings.Contains(record.Error, "InternalServerError") {
+		t.Errorf("unexpected retry record %s", output.String())
+	}
+}
+
+func TestCollector(t *testing.T) {
+	calls := 0
+	collector := &dynamodb.Collector{}
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls++; calls == 1 {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"__type":"com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ConsumedCapacity":{"TableName":"T","CapacityUnits":2.5}}`)
+	}, func(c *dynamodb.Config) { c.Metrics = collector })
+	if _, err := db.GetItem("T", dynamodb.Key{"Host": dynamodb.StringValue("localhost")}, &dynamodb.GetItemOptions{ReturnConsumedCapacity: "TOTAL"}); err != nil {
+		t.Fatal(err)
+	}
+	s := collector.Snapshot()[dynamodb.OperationKey{Operation: "GetItem", Table: "T"}]
+	if s.Requests != 1 || s.Retries != 1 || s.Throttles != 1 || s.ReadUnits != 2.5 || s.Latency.Count != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	w := httptest.NewRecorder()
+	collector.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{
+		`dynamodb_retries_total{operation="GetItem",table="T"} 1`,
+		`dynamodb_consumed_read_capacity_units_total{operation="GetItem",table="T"} 2.5`,
+		`dynamodb_request_duration_seconds_count{operation="GetItem",table="T"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, w.Body.String())
+		}
+	}
+}
+
+func TestCollectorTables(t *testing.T) {
+	calls := 0
+	var posted string
+	collector := &dynamodb.Collector{}
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		posted = string(b)
+		if calls++; calls == 1 {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"__type":"com.amazonaws.dynamodb.v20120810#ProvisionedThroughputExceededException"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ConsumedCapacity":[{"TableName":"A","CapacityUnits":2},{"TableName":"B","CapacityUnits":1}],"UnprocessedItems":{}}`)
+	}, func(c *dynamodb.Config) { c.Metrics = collector })
+	put := dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: dynamodb.Item{"Host": dynamodb.StringValue("localhost")}}}
+	r, err := db.BatchWriteItem(map[string][]dynamodb.WriteRequest{"A": {put}, "B": {put}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(posted, `"ReturnConsumedCapacity":"TOTAL"`) {
+		t.Errorf("expected the collector to ask for the consumed capacity, posted %s", posted)
+	}
+	if r.ConsumedCapacity != nil {
+		t.Errorf("expected the unrequested capacity to be left out of %+v", r)
+	}
+	snapshot := collector.Snapshot()
+	for table, units := range map[string]float64{"A": 2, "B": 1} {
+		s := snapshot[dynamodb.OperationKey{Operation: "BatchWriteItem", Table: table}]
+		if s.Requests != 1 || s.Retries != 1 || s.Throttles != 1 || s.WriteUnits != units {
+			t.Errorf("unexpected stats for %s %+v", table, s)
+		}
+	}
+	if _, ok := snapshot[dynamodb.OperationKey{Operation: "BatchWriteItem"}]; ok {
+		t.Errorf("expected no stats without a table, got %+v", snapshot)
+	}
+}
+
+func TestCRC32(t *testing.T) {
+	body := `{"Item":{"Host":{"S":"localhost"}}}`
+	corrupt := 1
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(body))), 10))
+		if corrupt > 0 {
+			corrupt--
+			fmt.Fprint(w, body[:len(body)-3])
+			return
+		}
+		fmt.Fprint(w, body)
+	}, func(c *dynamodb.Config) { c.RetryPolicy.(*dynamodb.BackoffRetryPolicy).MaxAttempts = 2 })
+	key := dynamodb.Key{"Host": dynamodb.StringValue("localhost")}
+	if r, err := db.GetItem("T", key, nil); err != nil {
+		t.Errorf("expected the corrupted response to be retried, got %v", err)
+	} else if !(*r.Item)["Host"].Equal(dynamodb.StringValue("localhost")) {
+		t.Errorf("unexpected item %v", r.Item)
+	}
+
+	corrupt = 2
+	if _, err := db.GetItem("T", key, nil); !errors.Is(err, dynamodb.ErrCRC32Mismatch) {
+		t.Errorf("expected ErrCRC32Mismatch, got %v", err)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "credentials")
+	ini := "[default]\naws_access_key_id = A\naws_secret_access_key = B\n\n[ci]\naws_access_key_id=C\naws_secret_access_key=D\naws_session_token=E\n"
+	if err := os.WriteFile(filename, []byte(ini), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	chain := dynamodb.CredentialsChain{dynamodb.StaticCredentials{}, &dynamodb.SharedCredentialsFile{Filename: filename, Profile: "ci"}}
+	c, err := chain.Retrieve(ctx)
+	if err != nil || c.AccessKeyID != "C" || c.SecretAccessKey != "D" || c.SessionToken != "E" {
+		t.Errorf("unexpected credentials %+v, %v", c, err)
+	}
+	if _, err := (&dynamodb.SharedCredentialsFile{Filename: filename, Profile: "missing"}).Retrieve(ctx); !errors.Is(err, dynamodb.ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+
+	calls := 0
+	refreshing := dynamodb.NewRefreshingCredentials(providerFunc(func(ctx context.Context) (dynamodb.Credentials, error) {
+		calls++
+		return dynamodb.Credentials{AccessKeyID: "A", SecretAccessKey: "B", Expires: time.Now().Add(30 * time.Second)}, nil
+	}), time.Minute)
+	refreshing.Retrieve(ctx)
+	refreshing.Retrieve(ctx)
+	if calls != 2 {
+		t.Errorf("expected credentials inside the expiry window to be refreshed, got %d retrievals", calls)
+	}
+
+	if _, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Credentials: dynamodb.StaticCredentials{}}); !errors.Is(err, dynamodb.ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+}
+
+type providerFunc func(ctx context.Context) (dynamodb.Credentials, error)
+
+func (f providerFunc) Retrieve(ctx context.Context) (dynamodb.Credentials, error) {
+	return f(ctx)
+}
+
+type countingTransport struct {
+	http.RoundTripper
+	requests atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return c.RoundTripper.RoundTrip(r)
+}
+
+func TestTransport(t *testing.T) {
+	var slow atomic.Bool
+	slow.Store(true)
+	transport := &countingTransport{RoundTripper: http.DefaultTransport}
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		if slow.CompareAndSwap(true, false) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{}`)
+	}, func(c *dynamodb.Config) {
+		c.Transport = transport
+		c.AttemptTimeout = 20 * time.Millisecond
+		c.RetryPolicy.(*dynamodb.BackoffRetryPolicy).MaxAttempts = 2
+	})
+	if _, err := db.GetItem("T", dynamodb.Key{"Host": dynamodb.StringValue("localhost")}, nil); err != nil {
+		t.Errorf("expected the timed out attempt to be retried, got %v", err)
+	}
+	if n := transport.requests.Load(); n != 2 {
+		t.Errorf("expected 2 requests through the transport, got %d", n)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	failing := true
+	var transitions []string
+	breaker := dynamodb.NewCircuitBreaker(0.5, 2, time.Minute, 20*time.Millisecond)
+	breaker.PerTable = true
+	breaker.OnStateChange = func(circuit string, from, to dynamodb.BreakerState) {
+		transitions = append(transitions, fmt.Sprintf("%s %v->%v", circuit, from, to))
+	}
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(500)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}, func(c *dynamodb.Config) {
+		c.CircuitBreaker = breaker
+		c.RetryPolicy.(*dynamodb.BackoffRetryPolicy).MaxAttempts = 5
+	})
+	key := dynamodb.Key{"Host": dynamodb.StringValue("localhost")}
+	if _, err := db.GetItem("T", key, nil); !errors.Is(err, dynamodb.ErrCircuitOpen) {
+		t.Errorf("expected the breaker to open during retries, got %v", err)
+	}
+	if breaker.State("Other") != dynamodb.BreakerClosed {
+		t.Error("the circuit of another table opened")
+	}
+
+	failing = false
+	time.Sleep(30 * time.Millisecond)
+	if _, err := db.GetItem("T", key, nil); err != nil {
+		t.Errorf("expected the probe to succeed, got %v", err)
+	}
+	if breaker.State("T") != dynamodb.BreakerClosed {
+		t.Errorf("expected the circuit to close, got %v", breaker.State("T"))
+	}
+	expected := "[T closed->open T open->half-open T half-open->closed]"
+	if fmt.Sprint(transitions) != expected {
+		t.Errorf("transitions %v, want %v", transitions, expected)
+	}
+}
+
+func TestHedging(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	metrics := &dynamodb.Collector{}
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		first := requests == 1
+		mu.Unlock()
+		if first {
+			ioutil.ReadAll(r.Body)
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		fmt.Fprint(w, `{"Item":{"Host":{"S":"localhost"}}}`)
+	}, func(c *dynamodb.Config) {
+		c.Hedging = &dynamodb.Hedging{Delay: 20 * time.Millisecond}
+		c.Metrics = metrics
+	})
+	start := time.Now()
+	r, err := db.GetItem("T", dynamodb.Key{"Host": dynamodb.StringValue("localhost")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("hedged read took %v", elapsed)
+	}
+	if !(*r.Item)["Host"].Equal(dynamodb.StringValue("localhost")) {
+		t.Errorf("unexpected item %v", r.Item)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if stats := metrics.Snapshot()[dynamodb.OperationKey{Operation: "GetItem", Table: "T"}]; stats.Requests != 1 || len(stats.Errors) != 0 || stats.Retries != 0 {
+		t.Errorf("expected one successful request in the metrics, got %+v", stats)
+	}
+}
+
+func TestHedgingDefaults(t *testing.T) {
+	var requests atomic.Int64
+	db := newTestDB(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, `{}`)
+	}, func(c *dynamodb.Config) { c.Hedging = &dynamodb.Hedging{} })
+	for i := 0; i < 30; i++ {
+		if _, err := db.GetItem("T", dynamodb.Key{"Host": dynamodb.StringValue("localhost")}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n > 40 {
+		t.Errorf("a zero Hedging should only hedge the slowest reads, sent %d requests for 30", n)
+	}
+}
+
+func TestListTables(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	pt := dynamodb.ProvisionedThroughput{ReadCapacityUnits: 1, WriteCapacityUnits: 1}
+	for _, name := range []string{"c", "a", "b"} {
+		if _, err := db.CreateTable(name, nil, []dynamodb.KeySchemaElement{{AttributeName: "K", KeyType: "HASH"}}, pt, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := db.ListTables(&dynamodb.ListTablesOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(r.TableNames) != "[a b]" || r.LastEvaluatedTableName != "b" {
+		t.Errorf("unexpected first page %+v", r)
+	}
+	names, err := dynamodb.ListAllTables(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[a b c]" {
+		t.Errorf("ListAllTables returned %v", names)
+	}
+}
+
+func TestMemoryBatchGetItem(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	table, err := db.Register("FetchRequest", (*FetchRequest)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateTable(table.TableName, table.AttributeDefinitions, table.KeySchema, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var keys []dynamodb.Key
+	for i := 0; i < 3; i++ {
+		f := &FetchRequest{Host: fmt.Sprintf("host-%d", i), URL: "http://example.com/", RequestedOn: "2013"}
+		if i < 2 {
+			if _, err := db.PutItem(table.TableName, db.ToItem(f), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		keys = append(keys, db.ToKey(f))
+	}
+	r, err := db.BatchGetItem(map[string]dynamodb.KeysAndAttributes{table.TableName: {Keys: keys, AttributesToGet: []string{"Host", "URL"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := r.Responses[table.TableName]
+	if len(items) != 2 || len(items[0]) != 2 || !items[1]["URL"].Equal(dynamodb.StringValue("http://example.com/")) {
+		t.Errorf("unexpected responses %v", r.Responses)
+	}
+	if len(r.UnprocessedKeys) != 0 {
+		t.Errorf("unexpected unprocessed keys %v", r.UnprocessedKeys)
+	}
+	if _, err := db.BatchGetItem(map[string]dynamodb.KeysAndAttributes{"Missing": {Keys: keys}}, nil); !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+}
+
+func TestMemoryBatchWriteItem(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	schema := []dynamodb.KeySchemaElement{{AttributeName: "K", KeyType: "HASH"}}
+	for _, name := range []string{"A", "B"} {
+		if _, err := db.CreateTable(name, nil, schema, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item := func(k string) dynamodb.Item { return dynamodb.Item{"K": dynamodb.StringValue(k)} }
+	put := func(k string) dynamodb.WriteRequest {
+		return dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item(k)}}
+	}
+	if _, err := db.BatchWriteItem(map[string][]dynamodb.WriteRequest{"A": {put("1"), put("2")}, "B": {put("3")}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.BatchWriteItem(map[string][]dynamodb.WriteRequest{"A": {{DeleteRequest: &dynamodb.DeleteRequest{Key: dynamodb.Key(item("1"))}}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.UnprocessedItems) != 0 {
+		t.Errorf("unexpected unprocessed items %v", r.UnprocessedItems)
+	}
+	if _, err := db.BatchWriteItem(map[string][]dynamodb.WriteRequest{"A": {put("4"), put("4")}}, nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected duplicate keys to be rejected, got %v", err)
+	}
+	if _, err := db.BatchWriteItem(map[string][]dynamodb.WriteRequest{"A": {put("5")}, "Missing": {put("6")}}, nil); !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+	for table, count := range map[string]int{"A": 1, "B": 1} {
+		if s, err := db.Scan(table, nil); err != nil || s.Count != count {
+			t.Errorf("expected %d items in %s, got %+v, %v", count, table, s, err)
+		}
+	}
+}
+
+// stingyDB processes one entry per table of each batch call, leaving the
+// rest unprocessed, and records the largest batch it was sent.
+type stingyDB struct {
+	dynamodb.DynamoDB
+	mu      sync.Mutex
+	largest int
+}
+
+func (db *stingyDB) saw(n int) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if n > db.largest {
+		db.largest = n
+	}
+}
+
+func (db *stingyDB) BatchGetItemWithContext(ctx context.Context, requestItems map[string]dynamodb.KeysAndAttributes, options *dynamodb.BatchGetItemOptions) (*dynamodb.BatchGetItemResult, error) {
+	process, unprocessed := make(map[string]dynamodb.KeysAndAttributes), make(map[string]dynamodb.KeysAndAttributes)
+	n := 0
+	for table, k := range requestItems {
+		n += len(k.Keys)
+		p, u := k, k
+		p.Keys, u.Keys = k.Keys[:1], k.Keys[1:]
+		process[table], unprocessed[table] = p, u
+	}
+	db.saw(n)
+	r, err := db.DynamoDB.BatchGetItemWithContext(ctx, process, options)
+	if err != nil {
+		return nil, err
+	}
+	r.UnprocessedKeys = unprocessed
+	return r, nil
+}
+
+func (db *stingyDB) BatchWriteItemWithContext(ctx context.Context, requestItems map[string][]dynamodb.WriteRequest, options *dynamodb.BatchWriteItemOptions) (*dynamodb.BatchWriteItemResult, error) {
+	process, unprocessed := make(map[string][]dynamodb.WriteRequest), make(map[string][]dynamodb.WriteRequest)
+	n := 0
+	for table, writes := range requestItems {
+		n += len(writes)
+		process[table], unprocessed[table] = writes[:1], writes[1:]
+	}
+	db.saw(n)
+	r, err := db.DynamoDB.BatchWriteItemWithContext(ctx, process, options)
+	if err != nil {
+		return nil, err
+	}
+	r.UnprocessedItems = unprocessed
+	return r, nil
+}
+
+func TestBatchAll(t *testing.T) {
+	db := &stingyDB{DynamoDB: dynamodb.NewMemoryDB()}
+	schema := []dynamodb.KeySchemaElement{{AttributeName: "K", KeyType: "HASH"}}
+	for _, name := range []string{"A", "B"} {
+		if _, err := db.CreateTable(name, nil, schema, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writes := make(map[string][]dynamodb.WriteRequest)
+	gets := make(map[string]dynamodb.KeysAndAttributes)
+	for i := 0; i < 120; i++ {
+		table := []string{"A", "B"}[i%2]
+		key := dynamodb.Key{"K": dynamodb.StringValue(strconv.Itoa(i))}
+		writes[table] = append(writes[table], dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: dynamodb.Item(key)}})
+		k := gets[table]
+		k.Keys = append(k.Keys, key)
+		gets[table] = k
+	}
+	options := &dynamodb.BatchOptions{Concurrency: 3, RetryPolicy: &dynamodb.BackoffRetryPolicy{BaseDelay: time.Microsecond, MaxDelay: time.Millisecond}}
+	if err := dynamodb.BatchWriteAll(context.Background(), db, writes, options); err != nil {
+		t.Fatal(err)
+	}
+	if db.largest != dynamodb.MaxBatchWriteItems {
+		t.Errorf("largest write batch was %d", db.largest)
+	}
+	db.largest = 0
+	items, err := dynamodb.BatchGetAll(context.Background(), db, gets, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items["A"]) != 60 || len(items["B"]) != 60 {
+		t.Errorf("read %d and %d items", len(items["A"]), len(items["B"]))
+	}
+	if db.largest != dynamodb.MaxBatchGetKeys {
+		t.Errorf("largest get batch was %d", db.largest)
+	}
+
+	options.RetryPolicy = &dynamodb.BackoffRetryPolicy{MaxAttempts: 1}
+	gets["Missing"] = dynamodb.KeysAndAttributes{Keys: []dynamodb.Key{{"K": dynamodb.StringValue("0")}}}
+	items, err = dynamodb.BatchGetAll(context.Background(), db, gets, options)
+	var batchErr *dynamodb.BatchError
+	if !errors.As(err, &batchErr) || !errors.Is(err, dynamodb.ErrUnprocessed) || !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Fatalf("expected a BatchError, got %v", err)
+	}
+	got := len(batchErr.Failures)
+	for _, table := range []string{"A", "B"} {
+		got += len(items[table])
+	}
+	if got != 121 {
+		t.Errorf("expected every key to be read or reported, got %d", got)
+	}
+}
+
+func TestAttributeValue(t *testing.T) {
+	item := dynamodb.Item{
+		"S":    dynamodb.StringValue("s"),
+		"N":    dynamodb.IntValue(-7),
+		"B":    dynamodb.BinaryValue([]byte("hi")),
+		"SS":   dynamodb.StringSetValue("a", "b"),
+		"NS":   dynamodb.NumberSetValue("1", "2.5"),
+		"BS":   dynamodb.BinarySetValue([]byte("x")),
+		"L":    dynamodb.ListValue(dynamodb.StringValue("e"), dynamodb.NullValue()),
+		"M":    dynamodb.MapValue(map[string]dynamodb.AttributeValue{"k": dynamodb.BoolValue(false)}),
+		"BOOL": dynamodb.BoolValue(true),
+		"NULL": dynamodb.NullValue(),
+	}
+	b, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = `{"B":{"B":"aGk="},"BOOL":{"BOOL":true},"BS":{"BS":["eA=="]},"L":{"L":[{"S":"e"},{"NULL":true}]},"M":{"M":{"k":{"BOOL":false}}},"N":{"N":"-7"},"NS":{"NS":["1","2.5"]},"NULL":{"NULL":true},"S":{"S":"s"},"SS":{"SS":["a","b"]}}`
+	if string(b) != expected {
+		t.Errorf("marshalled as %s", b)
+	}
+	var decoded dynamodb.Item
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for name, v := range item {
+		if !decoded[name].Equal(v) || decoded[name].Type() != name {
+			t.Errorf("%s decoded as %v", name, decoded[name])
+		}
+	}
+	if n, ok := decoded["N"].AsInt(); !ok || n != -7 {
+		t.Errorf("AsInt returned %v, %v", n, ok)
+	}
+	if _, ok := decoded["N"].AsString(); ok {
+		t.Error("AsString accepted an N value")
+	}
+	if !dynamodb.NumberSetValue("2.50", "1").Equal(item["NS"]) || dynamodb.StringSetValue("a").Equal(item["SS"]) {
+		t.Error("sets compare incorrectly")
+	}
+	for _, bad := range []string{`{}`, `{"S":"a","N":"1"}`, `{"X":"a"}`, `{"NULL":false}`, `{"N":1}`} {
+		var v dynamodb.AttributeValue
+		if err := json.Unmarshal([]byte(bad), &v); err == nil {
+			t.Errorf("%s decoded as %v", bad, v)
+		}
+	}
+	if _, err := json.Marshal(dynamodb.Item{"Zero": {}}); err == nil {
+		t.Error("the zero AttributeValue marshalled")
+	}
+}
+
+type Profile struct {
+	Name    string `db:"HASH"`
+	Age     uint8
+	Score   float64
+	Admin   bool
+	Tags    []string
+	Avatar  []byte
+	Website *url.URL
+}
+
+func TestMappingTypes(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	if _, err := db.Register("Profile", (*Profile)(nil)); err != nil {
+		t.Fatal(err)
+	}
+	website, _ := url.Parse("http://example.com/")
+	p := &Profile{Name: "a", Age: 30, Score: 1.5, Admin: true, Tags: []string{"x", "y"}, Avatar: []byte{1}, Website: website}
+	item := db.ToItem(p)
+	if !item["Tags"].Equal(dynamodb.StringSetValue("y", "x")) || !item["Admin"].Equal(dynamodb.BoolValue(true)) || !item["Score"].Equal(dynamodb.NumberValue("1.5")) {
+		t.Errorf("unexpected item %v", item)
+	}
+	if got, err := dynamodb.FromItemErr(db, "Profile", item); err != nil || fmt.Sprint(got.(*Profile)) != fmt.Sprint(p) {
+		t.Errorf("round trip gave %+v, %v", got, err)
+	}
+	item["Name"] = dynamodb.IntValue(7)
+	if _, err := dynamodb.FromItemErr(db, "Profile", item); err == nil || !strings.Contains(err.Error(), "Name") {
+		t.Errorf("expected an error for a number stored in a string field, got %v", err)
+	}
+	if _, err := dynamodb.FromItemErr(struct{ dynamodb.Mapping }{db}, "Profile", item); err == nil {
+		t.Error("expected an error from a Mapping that only panics")
+	}
+	if _, err := dynamodb.FromItemErr(db, "Missing", item); err == nil {
+		t.Error("expected an error for an unregistered table")
+	}
+	if item := db.ToItem(&Profile{Name: "b"}); len(item) != 5 {
+		t.Errorf("empty sets, strings and URLs should be left out, got %v", item)
+	}
+}
+
+func TestExpressionBuilder(t *testing.T) {
+	e, err := dynamodb.ExpressionBuilder{}.
+		WithKeyCondition(dynamodb.And(
+			dynamodb.Equal(dynamodb.Name("Host"), dynamodb.Value(dynamodb.StringValue("example.com"))),
+			dynamodb.BeginsWith(dynamodb.Name("Path"), "/a"))).
+		WithFilter(dynamodb.Or(
+			dynamodb.Not(dynamodb.AttributeNotExists(dynamodb.Name("Status"))),
+			dynamodb.In(dynamodb.Name("Status"), dynamodb.Value(dynamodb.IntValue(200)), dynamodb.Value(dynamodb.IntValue(304))),
+			dynamodb.GreaterThan(dynamodb.Size(dynamodb.Name("Tags")), dynamodb.Value(dynamodb.IntValue(2))))).
+		WithProjection(dynamodb.Name("Host"), dynamodb.Name("Meta.Redirects[1]")).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.KeyCondition != "(#n0 = :v0) AND (begins_with(#n1, :v1))" {
+		t.Errorf("key condition %q", e.KeyCondition)
+	}
+	if e.Filter != "(NOT (attribute_not_exists(#n2))) OR (#n2 IN (:v2, :v3)) OR (size(#n3) > :v4)" {
+		t.Errorf("filter %q", e.Filter)
+	}
+	if e.Projection != "#n0, #n4.#n5[1]" {
+		t.Errorf("projection %q", e.Projection)
+	}
+	if fmt.Sprint(e.Names) != "map[#n0:Host #n1:Path #n2:Status #n3:Tags #n4:Meta #n5:Redirects]" || len(e.Values) != 5 || !e.Values[":v1"].Equal(dynamodb.StringValue("/a")) {
+		t.Errorf("placeholders %v %v", e.Names, e.Values)
+	}
+
+	base := dynamodb.UpdateBuilder{}.Set(dynamodb.Name("A"), dynamodb.IfNotExists(dynamodb.Name("A"), dynamodb.Value(dynamodb.IntValue(0))))
+	u := base.Remove(dynamodb.Name("B")).Add(dynamodb.Name("C"), dynamodb.Value(dynamodb.StringSetValue("x"))).Delete(dynamodb.Name("D"), dynamodb.Value(dynamodb.StringSetValue("y")))
+	e, err = dynamodb.ExpressionBuilder{}.WithUpdate(u).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Update != "SET #n0 = if_not_exists(#n0, :v0) REMOVE #n1 ADD #n2 :v1 DELETE #n3 :v2" {
+		t.Errorf("update %q", e.Update)
+	}
+	if e, err = (dynamodb.ExpressionBuilder{}).WithUpdate(base.Set(dynamodb.Name("E"), dynamodb.ListAppend(dynamodb.Name("E"), dynamodb.Value(dynamodb.ListValue())))).Build(); err != nil || e.Update != "SET #n0 = if_not_exists(#n0, :v0), #n1 = list_append(#n1, :v1)" {
+		t.Errorf("update %q, %v", e.Update, err)
+	}
+
+	for name, b := range map[string]dynamodb.ExpressionBuilder{
+		"empty":        {},
+		"empty update": dynamodb.ExpressionBuilder{}.WithUpdate(dynamodb.UpdateBuilder{}),
+		"empty and":    dynamodb.ExpressionBuilder{}.WithCondition(dynamodb.And()),
+		"zero value":   dynamodb.ExpressionBuilder{}.WithCondition(dynamodb.Equal(dynamodb.Name("A"), dynamodb.Value(dynamodb.AttributeValue{}))),
+		"bad path":     dynamodb.ExpressionBuilder{}.WithProjection(dynamodb.Name("A..B")),
+		"bad index":    dynamodb.ExpressionBuilder{}.WithProjection(dynamodb.Name("A[x]")),
+		"no condition": dynamodb.ExpressionBuilder{}.WithFilter(dynamodb.ConditionBuilder{}),
+	} {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: built without error", name)
+		}
+	}
+}
+
+func TestMemoryExpressions(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	schema := []dynamodb.KeySchemaElement{{AttributeName: "Host", KeyType: "HASH"}, {AttributeName: "Path", KeyType: "RANGE"}}
+	if _, err := db.CreateTable("T", nil, schema, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	s, n := dynamodb.StringValue, dynamodb.IntValue
+	key := dynamodb.Key{"Host": s("a"), "Path": s("/")}
+
+	// Conditional writes.
+	put := &dynamodb.PutItemOptions{ConditionExpression: "attribute_not_exists(Host)"}
+	if _, err := db.PutItem("T", dynamodb.Item{"Host": s("a"), "Path": s("/"), "Hits": n(1)}, put); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.PutItem("T", dynamodb.Item{"Host": s("a"), "Path": s("/")}, put); !errors.Is(err, dynamodb.ErrConditionalCheckFailed) {
+		t.Errorf("expected the second put to fail its condition, got %v", err)
+	}
+	exists := false
+	if _, err := db.PutItem("T", dynamodb.Item{"Host": s("a"), "Path": s("/")}, &dynamodb.PutItemOptions{Expected: map[string]dynamodb.ExpectedAttributeValue{"Host": {Exists: &exists}}}); !errors.Is(err, dynamodb.ErrConditionalCheckFailed) {
+		t.Errorf("expected Expected to be checked, got %v", err)
+	}
+
+	// Updates.
+	e, err := dynamodb.ExpressionBuilder{}.
+		WithCondition(dynamodb.Between(dynamodb.Name("Hits"), dynamodb.Value(n(0)), dynamodb.Value(n(5)))).
+		WithUpdate(dynamodb.UpdateBuilder{}.
+			Set(dynamodb.Name("Hits"), dynamodb.Plus(dynamodb.Name("Hits"), dynamodb.Value(dynamodb.NumberValue("1.5")))).
+			Set(dynamodb.Name("Log"), dynamodb.ListAppend(dynamodb.IfNotExists(dynamodb.Name("Log"), dynamodb.Value(dynamodb.ListValue())), dynamodb.Value(dynamodb.ListValue(s("x"), s("y"))))).
+			Set(dynamodb.Name("Meta"), dynamodb.Value(dynamodb.MapValue(map[string]dynamodb.AttributeValue{"Owner": s("me")}))).
+			Add(dynamodb.Name("Tags"), dynamodb.Value(dynamodb.StringSetValue("p", "q")))).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.UpdateItem("T", key, &dynamodb.UpdateItemOptions{ConditionExpression: e.Condition, UpdateExpression: e.Update, ExpressionAttributeNames: e.Names, ExpressionAttributeValues: e.Values, ReturnValues: "UPDATED_NEW"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Attributes) != 4 || !r.Attributes["Hits"].Equal(dynamodb.NumberValue("2.5")) || !r.Attributes["Log"].Equal(dynamodb.ListValue(s("x"), s("y"))) {
+		t.Errorf("UPDATED_NEW returned %v", r.Attributes)
+	}
+	r, err = db.UpdateItem("T", key, &dynamodb.UpdateItemOptions{
+		UpdateExpression:          "SET Meta.Size = :size, #log[5] = :z REMOVE #log[0] DELETE Tags :p",
+		ExpressionAttributeNames:  map[string]string{"#log": "Log"},
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":size": n(3), ":z": s("z"), ":p": dynamodb.StringSetValue("p")},
+		ReturnValues:              "ALL_NEW",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := dynamodb.MapValue(map[string]dynamodb.AttributeValue{
+		"Host": s("a"), "Path": s("/"), "Hits": dynamodb.NumberValue("2.5"),
+		"Log":  dynamodb.ListValue(s("y"), s("z")),
+		"Meta": dynamodb.MapValue(map[string]dynamodb.AttributeValue{"Owner": s("me"), "Size": n(3)}),
+		"Tags": dynamodb.StringSetValue("q"),
+	})
+	if !dynamodb.MapValue(r.Attributes).Equal(expected) {
+		t.Errorf("ALL_NEW returned %v", r.Attributes)
+	}
+	if _, err := db.UpdateItem("T", key, &dynamodb.UpdateItemOptions{UpdateExpression: "SET Hits = :v", ConditionExpression: "Hits > :v", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": n(10)}}); !errors.Is(err, dynamodb.ErrConditionalCheckFailed) {
+		t.Errorf("expected a failed condition, got %v", err)
+	}
+	if _, err := db.UpdateItem("T", dynamodb.Key{"Host": s("b"), "Path": s("/")}, &dynamodb.UpdateItemOptions{AttributeUpdates: map[string]dynamodb.AttributeValueUpdate{"Hits": {Action: "ADD", Value: n(1)}}}); err != nil {
+		t.Errorf("legacy update: %v", err)
+	}
+
+	for name, options := range map[string]*dynamodb.UpdateItemOptions{
+		"syntax":         {UpdateExpression: "SET Hits = "},
+		"undefined name": {UpdateExpression: "SET #h = :v", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": n(1)}},
+		"unused value":   {UpdateExpression: "REMOVE Meta", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": n(1)}},
+		"overlap":        {UpdateExpression: "SET Meta.Owner = :v REMOVE Meta", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": n(1)}},
+		"key":            {UpdateExpression: "SET Path = :v", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": s("/x")}},
+		"type":           {UpdateExpression: "SET Hits = Tags + :v", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": n(1)}},
+		"mixed":          {UpdateExpression: "REMOVE Meta", Expected: map[string]dynamodb.ExpectedAttributeValue{"Hits": {Value: n(1)}}},
+	} {
+		if _, err := db.UpdateItem("T", key, options); !errors.Is(err, dynamodb.ErrValidation) {
+			t.Errorf("%s: expected a ValidationException, got %v", name, err)
+		}
+	}
+
+	// Reads.
+	for i := 0; i < 5; i++ {
+		item := dynamodb.Item{"Host": s("c"), "Path": s(fmt.Sprintf("/%d", i)), "Size": n(int64(i * 10))}
+		if _, err := db.PutItem("T", item, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := db.GetItem("T", key, &dynamodb.GetItemOptions{ProjectionExpression: "Meta.Owner, Log[1]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dynamodb.MapValue(*g.Item).Equal(dynamodb.MapValue(map[string]dynamodb.AttributeValue{"Meta": dynamodb.MapValue(map[string]dynamodb.AttributeValue{"Owner": s("me")}), "Log": dynamodb.ListValue(s("z"))})) {
+		t.Errorf("projected %v", *g.Item)
+	}
+	backward := false
+	query := &dynamodb.QueryOptions{
+		KeyConditionExpression:    "Host = :h AND Path BETWEEN :from AND :to",
+		FilterExpression:          "Size <> :skip",
+		ProjectionExpression:      "Size",
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":h": s("c"), ":from": s("/1"), ":to": s("/4"), ":skip": n(30)},
+		ScanIndexForward:          &backward,
+		Limit:                     2,
+	}
+	var sizes []string
+	for {
+		q, err := db.Query("T", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range q.Items {
+			sizes = append(sizes, item["Size"].String())
+		}
+		if q.LastEvaluatedKey == nil {
+			break
+		}
+		query.ExclusiveStartKey = q.LastEvaluatedKey
+	}
+	if strings.Join(sizes, " ") != `{"N":"40"} {"N":"20"} {"N":"10"}` {
+		t.Errorf("query returned %v", sizes)
+	}
+	if _, err := db.Query("T", &dynamodb.QueryOptions{KeyConditionExpression: "Size = :v", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":v": n(1)}}); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a query on a non-key attribute to fail, got %v", err)
+	}
+	legacy, err := db.Query("T", &dynamodb.QueryOptions{KeyConditions: dynamodb.KeyConditions{"Host": {AttributeValueList: []dynamodb.AttributeValue{s("c")}, ComparisonOperator: "EQ"}, "Path": {AttributeValueList: []dynamodb.AttributeValue{s("/3")}, ComparisonOperator: "GE"}}})
+	if err != nil || legacy.Count != 2 {
+		t.Errorf("legacy query returned %+v, %v", legacy, err)
+	}
+	scan, err := db.Scan("T", &dynamodb.ScanOptions{FilterExpression: "contains(Tags, :t) OR size(Path) > :n", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":t": s("q"), ":n": n(1)}, Select: "COUNT"})
+	if err != nil || scan.Count != 6 || scan.ScannedCount != 7 || scan.Items != nil {
+		t.Errorf("scan returned %+v, %v", scan, err)
+	}
+}
+
+func TestMemoryKeys(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	definitions := []dynamodb.AttributeDefinition{{AttributeName: "H", AttributeType: "S"}, {AttributeName: "R", AttributeType: "S"}}
+	schema := []dynamodb.KeySchemaElement{{AttributeName: "H", KeyType: "HASH"}, {AttributeName: "R", KeyType: "RANGE"}}
+	if _, err := db.CreateTable("T", definitions, schema, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := dynamodb.StringValue
+	for _, key := range []dynamodb.Item{{"H": s("a\x00b"), "R": s("c")}, {"H": s("a"), "R": s("b\x00c")}} {
+		if _, err := db.PutItem("T", key, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, err := db.Scan("T", nil); err != nil || r.Count != 2 {
+		t.Errorf("expected keys whose parts hold NULs to be distinct, got %+v, %v", r, err)
+	}
+	if _, err := db.PutItem("T", dynamodb.Item{"H": dynamodb.NumberValue("1"), "R": s("c")}, nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a ValidationException for a key of the wrong type, got %v", err)
+	}
+	key := dynamodb.Key{"H": s("a"), "R": s("b\x00c"), "Extra": s("x")}
+	if _, err := db.GetItem("T", key, nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a ValidationException for GetItem with a non-key attribute, got %v", err)
+	}
+	if _, err := db.DeleteItem("T", key, nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a ValidationException for DeleteItem with a non-key attribute, got %v", err)
+	}
+}
+
+func TestMemoryCopiesItems(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	if _, err := db.CreateTable("T", nil, []dynamodb.KeySchemaElement{{AttributeName: "ID", KeyType: "HASH"}}, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	s := dynamodb.StringValue
+	key := dynamodb.Key{"ID": s("a")}
+	item := dynamodb.Item{"ID": s("a"), "Tags": dynamodb.ListValue(s("x")), "Name": s("ann")}
+	if _, err := db.PutItem("T", item, nil); err != nil {
+		t.Fatal(err)
+	}
+	item["Name"] = s("bob")
+	tags, _ := item["Tags"].AsList()
+	tags[0] = s("changed")
+
+	get := func() dynamodb.Item {
+		r, err := db.GetItem("T", key, nil)
+		if err != nil || r.Item == nil {
+			t.Fatalf("got %v, %v", r, err)
+		}
+		return *r.Item
+	}
+	want := dynamodb.Item{"ID": s("a"), "Tags": dynamodb.ListValue(s("x")), "Name": s("ann")}
+	if got := get(); !dynamodb.MapValue(got).Equal(dynamodb.MapValue(want)) {
+		t.Errorf("changing an item after PutItem changed the stored item: %v", got)
+	}
+	got := get()
+	got["Name"] = s("bob")
+	tags, _ = got["Tags"].AsList()
+	tags[0] = s("changed")
+	scanned, err := db.Scan("T", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(scanned.Items[0], "Name")
+	if got := get(); !dynamodb.MapValue(got).Equal(dynamodb.MapValue(want)) {
+		t.Errorf("changing a returned item changed the stored item: %v", got)
+	}
+}
+
+func TestMemoryNumberKeys(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	if _, err := db.CreateTable("T", nil, []dynamodb.KeySchemaElement{{AttributeName: "ID", KeyType: "HASH"}}, dynamodb.ProvisionedThroughput{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	n := dynamodb.NumberValue
+	for _, id := range []string{"1", "1.0", "10e-1"} {
+		if _, err := db.PutItem("T", dynamodb.Item{"ID": n(id)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, err := db.Scan("T", nil); err != nil || s.Count != 1 {
+		t.Errorf("expected equal numbers to be one key, got %+v, %v", s, err)
+	}
+	if r, err := db.GetItem("T", dynamodb.Key{"ID": n("1.00")}, nil); err != nil || r.Item == nil {
+		t.Errorf("expected to get the item by an equal number, got %v, %v", r, err)
+	}
+	if _, err := db.GetItem("T", dynamodb.Key{"ID": n("one")}, nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a ValidationException for a malformed number, got %v", err)
+	}
+	if _, err := db.PutItem("T", dynamodb.Item{"ID": dynamodb.StringValue("1")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := db.Scan("T", nil); err != nil || s.Count != 2 {
+		t.Errorf("expected S \"1\" and N \"1\" to be distinct keys, got %+v, %v", s, err)
+	}
+	if r, err := db.GetItem("T", dynamodb.Key{"ID": n("1")}, nil); err != nil || r.Item == nil || (*r.Item)["ID"].Type() != "N" {
+		t.Errorf("expected the number item, got %v, %v", r, err)
+	}
+}
+
+func TestMemoryGlobalSecondaryIndexes(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	schema := []dynamodb.KeySchemaElement{{AttributeName: "ID", KeyType: "HASH"}}
+	byOwner := dynamodb.GlobalSecondaryIndex{
+		IndexName:  "ByOwner",
+		KeySchema:  []dynamodb.KeySchemaElement{{AttributeName: "Owner", KeyType: "HASH"}, {AttributeName: "Created", KeyType: "RANGE"}},
+		Projection: dynamodb.Projection{ProjectionType: "INCLUDE", NonKeyAttributes: []string{"Title"}},
+	}
+	if _, err := db.CreateTable("T", nil, schema, dynamodb.ProvisionedThroughput{}, &dynamodb.CreateTableOptions{GlobalSecondaryIndexes: []dynamodb.GlobalSecondaryIndex{byOwner}}); err != nil {
+		t.Fatal(err)
+	}
+	s, n := dynamodb.StringValue, dynamodb.IntValue
+	for i, owner := range []string{"ann", "bob", "ann", "", "ann"} {
+		item := dynamodb.Item{"ID": n(int64(i)), "Created": n(int64(10 - i)), "Title": s(fmt.Sprint("t", i)), "Body": s("...")}
+		if owner != "" {
+			item["Owner"] = s(owner)
+		}
+		if _, err := db.PutItem("T", item, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := db.DescribeTable("T", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gsis := d.Table.GlobalSecondaryIndexes; len(gsis) != 1 || gsis[0].IndexStatus != "ACTIVE" || gsis[0].ItemCount != 4 {
+		t.Errorf("described %+v", gsis)
+	}
+
+	q, err := db.Query("T", &dynamodb.QueryOptions{IndexName: "ByOwner", KeyConditionExpression: "#o = :o", ExpressionAttributeNames: map[string]string{"#o": "Owner"}, ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":o": s("ann")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, item := range q.Items {
+		title, _ := item["Title"].AsString()
+		titles = append(titles, title)
+		if _, ok := item["Body"]; ok || len(item) != 4 {
+			t.Errorf("the index should not project %v", item)
+		}
+	}
+	if strings.Join(titles, " ") != "t4 t2 t0" {
+		t.Errorf("queried %v", titles)
+	}
+	if _, err := db.Query("T", &dynamodb.QueryOptions{IndexName: "ByOwner", ConsistentRead: true, KeyConditionExpression: "Owner = :o", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":o": s("ann")}}); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected consistent reads of a global index to fail, got %v", err)
+	}
+
+	byTitle := &dynamodb.CreateGlobalSecondaryIndexAction{IndexName: "ByTitle", KeySchema: []dynamodb.KeySchemaElement{{AttributeName: "Title", KeyType: "HASH"}}, Projection: dynamodb.Projection{ProjectionType: "ALL"}}
+	u, err := db.UpdateTable("T", dynamodb.ProvisionedThroughput{}, &dynamodb.UpdateTableOptions{GlobalSecondaryIndexUpdates: []dynamodb.GlobalSecondaryIndexUpdate{{Create: byTitle}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(u.TableDescription.GlobalSecondaryIndexes) != 2 {
+		t.Errorf("expected two indexes, got %+v", u.TableDescription.GlobalSecondaryIndexes)
+	}
+	q, err = db.Query("T", &dynamodb.QueryOptions{IndexName: "ByTitle", KeyConditionExpression: "Title = :t", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":t": s("t3")}})
+	if err != nil || q.Count != 1 || len(q.Items[0]) != 4 {
+		t.Errorf("queried the new index: %+v, %v", q, err)
+	}
+	for name, updates := range map[string][]dynamodb.GlobalSecondaryIndexUpdate{
+		"duplicate": {{Create: byTitle}},
+		"two":       {{Delete: &dynamodb.DeleteGlobalSecondaryIndexAction{IndexName: "ByTitle"}}, {Delete: &dynamodb.DeleteGlobalSecondaryIndexAction{IndexName: "ByOwner"}}},
+		"both":      {{Create: byTitle, Delete: &dynamodb.DeleteGlobalSecondaryIndexAction{IndexName: "ByTitle"}}},
+	} {
+		if _, err := db.UpdateTable("T", dynamodb.ProvisionedThroughput{}, &dynamodb.UpdateTableOptions{GlobalSecondaryIndexUpdates: updates}); !errors.Is(err, dynamodb.ErrValidation) {
+			t.Errorf("%s: expected a ValidationException, got %v", name, err)
+		}
+	}
+	if _, err := db.UpdateTable("T", dynamodb.ProvisionedThroughput{}, &dynamodb.UpdateTableOptions{GlobalSecondaryIndexUpdates: []dynamodb.GlobalSecondaryIndexUpdate{{Update: &dynamodb.UpdateGlobalSecondaryIndexAction{IndexName: "Missing"}}}}); !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+	if _, err := db.UpdateTable("T", dynamodb.ProvisionedThroughput{}, &dynamodb.UpdateTableOptions{GlobalSecondaryIndexUpdates: []dynamodb.GlobalSecondaryIndexUpdate{{Delete: &dynamodb.DeleteGlobalSecondaryIndexAction{IndexName: "ByOwner"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Query("T", &dynamodb.QueryOptions{IndexName: "ByOwner", KeyConditionExpression: "Owner = :o", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":o": s("ann")}}); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected querying a deleted index to fail, got %v", err)
+	}
+}
+
+func TestMemoryTransactions(t *testing.T) {
+	db := dynamodb.NewMemoryDB()
+	pt := dynamodb.ProvisionedThroughput{ReadCapacityUnits: 1, WriteCapacityUnits: 1}
+	for _, name := range []string{"Orders", "Inventory"} {
+		if _, err := db.CreateTable(name, nil, []dynamodb.KeySchemaElement{{AttributeName: "ID", KeyType: "HASH"}}, pt, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, n := dynamodb.StringValue, dynamodb.IntValue
+	widget := dynamodb.Key{"ID": s("widget")}
+	if _, err := db.PutItem("Inventory", dynamodb.Item{"ID": s("widget"), "Stock": n(1)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	order := func(id string) []dynamodb.TransactWriteItem {
+		return []dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{TableName: "Orders", Item: dynamodb.Item{"ID": s(id), "Product": s("widget")}, ConditionExpression: "attribute_not_exists(ID)"}},
+			{Update: &dynamodb.Update{TableName: "Inventory", Key: widget, UpdateExpression: "SET Stock = Stock - :one", ConditionExpression: "Stock >= :one", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":one": n(1)}, ReturnValuesOnConditionCheckFailure: "ALL_OLD"}},
+		}
+	}
+	stock := func() int64 {
+		r, err := db.GetItem("Inventory", widget, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := (*r.Item)["Stock"].AsInt()
+		return v
+	}
+
+	if _, err := db.TransactWriteItems(order("o1"), &dynamodb.TransactWriteItemsOptions{ClientRequestToken: "o1"}); err != nil {
+		t.Fatal(err)
+	}
+	if stock() != 0 {
+		t.Errorf("expected the order to take the stock, have %d", stock())
+	}
+	if _, err := db.TransactWriteItems(order("o1"), &dynamodb.TransactWriteItemsOptions{ClientRequestToken: "o1"}); err != nil || stock() != 0 {
+		t.Errorf("expected a repeated token to succeed without writing, got %v and stock %d", err, stock())
+	}
+	if _, err := db.TransactWriteItems(order("o2"), &dynamodb.TransactWriteItemsOptions{ClientRequestToken: "o1"}); !errors.Is(err, dynamodb.ErrIdempotentParameterMismatch) {
+		t.Errorf("expected ErrIdempotentParameterMismatch, got %v", err)
+	}
+
+	_, err := db.TransactWriteItems(order("o2"), nil)
+	var apiErr *dynamodb.APIError
+	if !errors.Is(err, dynamodb.ErrTransactionCanceled) || !errors.As(err, &apiErr) {
+		t.Fatalf("expected ErrTransactionCanceled, got %v", err)
+	}
+	if reasons := apiErr.CancellationReasons; len(reasons) != 2 || reasons[0].Code != "None" || reasons[1].Code != "ConditionalCheckFailed" || !reasons[1].Item["Stock"].Equal(n(0)) {
+		t.Errorf("unexpected cancellation reasons %+v", reasons)
+	}
+	if r, err := db.GetItem("Orders", dynamodb.Key{"ID": s("o2")}, nil); err != nil || r.Item != nil {
+		t.Errorf("the canceled order should not be written: %v, %v", r.Item, err)
+	}
+
+	for name, items := range map[string][]dynamodb.TransactWriteItem{
+		"empty":     {},
+		"twice":     {{Delete: &dynamodb.Delete{TableName: "Orders", Key: dynamodb.Key{"ID": s("o1")}}}, {ConditionCheck: &dynamodb.ConditionCheck{TableName: "Orders", Key: dynamodb.Key{"ID": s("o1")}, ConditionExpression: "attribute_exists(ID)"}}},
+		"both":      {{Put: &dynamodb.Put{TableName: "Orders", Item: dynamodb.Item{"ID": s("o3")}}, Delete: &dynamodb.Delete{TableName: "Orders", Key: dynamodb.Key{"ID": s("o3")}}}},
+		"unused":    {{Delete: &dynamodb.Delete{TableName: "Orders", Key: dynamodb.Key{"ID": s("o1")}, ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":x": n(1)}}}},
+		"key":       {{Update: &dynamodb.Update{TableName: "Orders", Key: dynamodb.Key{"ID": s("o1")}, UpdateExpression: "SET ID = :x", ExpressionAttributeValues: map[string]dynamodb.AttributeValue{":x": s("o9")}}}},
+		"condition": {{ConditionCheck: &dynamodb.ConditionCheck{TableName: "Orders", Key: dynamodb.Key{"ID": s("o1")}}}},
+	} {
+		if _, err := db.TransactWriteItems(items, nil); !errors.Is(err, dynamodb.ErrValidation) {
+			t.Errorf("%s: expected a ValidationException, got %v", name, err)
+		}
+	}
+	if r, err := db.GetItem("Orders", dynamodb.Key{"ID": s("o1")}, nil); err != nil || r.Item == nil {
+		t.Errorf("an invalid transaction should not write: %v, %v", r.Item, err)
+	}
+
+	g, err := db.TransactGetItems([]dynamodb.TransactGetItem{
+		{Get: &dynamodb.Get{TableName: "Orders", Key: dynamodb.Key{"ID": s("o1")}, ProjectionExpression: "Product"}},
+		{Get: &dynamodb.Get{TableName: "Orders", Key: dynamodb.Key{"ID": s("o2")}}},
+		{Get: &dynamodb.Get{TableName: "Inventory", Key: widget}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := g.Responses; len(r) != 3 || len(r[0].Item) != 1 || !r[0].Item["Product"].Equal(s("widget")) || r[1].Item != nil || !r[2].Item["Stock"].Equal(n(0)) {
+		t.Errorf("got %+v", g.Responses)
+	}
+	if _, err := db.TransactGetItems([]dynamodb.TransactGetItem{{Get: &dynamodb.Get{TableName: "Missing", Key: widget}}}, nil); !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+}
+
 func TestAll(t *testing.T) {
 	testCreateTable(t)
 	testDescribeTable(t)
@@ -0,0 +1,117 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is an error reported by DynamoDB, or by the memory backend on
+// its behalf.
+type APIError struct {
+	Code       string // e.g. "ConditionalCheckFailedException"
+	Message    string
+	StatusCode int
+	RequestID  string
+
+	// CancellationReasons explains a TransactionCanceledException, with
+	// one reason for each item of the transaction.
+	CancellationReasons []CancellationReason
+}
+
+func (e *APIError) Error() string {
+	s := e.Code
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	if e.StatusCode != 0 {
+		s += fmt.Sprintf(" (status %d", e.StatusCode)
+		if e.RequestID != "" {
+			s += ", request id " + e.RequestID
+		}
+		s += ")"
+	}
+	return s
+}
+
+// Is reports whether target is an *APIError with the same Code, so that the
+// sentinel errors below can be used with errors.Is.
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// Sentinel errors for the codes of the API Version 2012-08-10; compare with
+// errors.Is.
+var (
+	ErrAccessDenied                    = &APIError{Code: "AccessDeniedException"}
+	ErrConditionalCheckFailed          = &APIError{Code: "ConditionalCheckFailedException"}
+	ErrIdempotentParameterMismatch     = &APIError{Code: "IdempotentParameterMismatchException"}
+	ErrIncompleteSignature             = &APIError{Code: "IncompleteSignatureException"}
+	ErrInternalServerError             = &APIError{Code: "InternalServerError"}
+	ErrItemCollectionSizeLimitExceeded = &APIError{Code: "ItemCollectionSizeLimitExceededException"}
+	ErrLimitExceeded                   = &APIError{Code: "LimitExceededException"}
+	ErrMissingAuthenticationToken      = &APIError{Code: "MissingAuthenticationTokenException"}
+	ErrProvisionedThroughputExceeded   = &APIError{Code: "ProvisionedThroughputExceededException"}
+	ErrRequestLimitExceeded            = &APIError{Code: "RequestLimitExceeded"}
+	ErrResourceInUse                   = &APIError{Code: "ResourceInUseException"}
+	ErrResourceNotFound                = &APIError{Code: "ResourceNotFoundException"}
+	ErrSerialization                   = &APIError{Code: "SerializationException"}
+	ErrServiceUnavailable              = &APIError{Code: "ServiceUnavailable"}
+	ErrThrottling                      = &APIError{Code: "ThrottlingException"}
+	ErrTransactionCanceled             = &APIError{Code: "TransactionCanceledException"}
+	ErrTransactionConflict             = &APIError{Code: "TransactionConflictException"}
+	ErrTransactionInProgress           = &APIError{Code: "TransactionInProgressException"}
+	ErrUnrecognizedClient              = &APIError{Code: "UnrecognizedClientException"}
+	ErrValidation                      = &APIError{Code: "ValidationException"}
+)
+
+// ErrCRC32Mismatch is returned, and retried by default, when a response
+// body does not match the checksum in its X-Amz-Crc32 header.
+var ErrCRC32Mismatch = errors.New("dynamodb: response body does not match its X-Amz-Crc32 checksum")
+
+// ErrAttemptTimeout is returned, and retried by default, when an attempt
+// takes longer than Config.AttemptTimeout.
+var ErrAttemptTimeout = errors.New("dynamodb: attempt timed out")
+
+// newAPIError decodes the error b returned in response.
+func newAPIError(response *http.Response, b []byte) *APIError {
+	e := &APIError{StatusCode: response.StatusCode, RequestID: response.Header.Get("X-Amzn-Requestid")}
+	var body struct {
+		Type                string `json:"__type"`
+		Message             string
+		CancellationReasons []CancellationReason
+	}
+	if json.Unmarshal(b, &body) == nil && body.Type != "" {
+		e.Code = body.Type[strings.LastIndex(body.Type, "#")+1:]
+		e.Message = body.Message
+		e.CancellationReasons = body.CancellationReasons
+	} else if len(b) > 0 {
+		e.Message = string(b)
+	}
+	if e.Code == "" {
+		switch {
+		case response.StatusCode == http.StatusServiceUnavailable:
+			e.Code = ErrServiceUnavailable.Code
+		case response.StatusCode >= 500:
+			e.Code = ErrInternalServerError.Code
+		default:
+			e.Code = http.StatusText(response.StatusCode)
+		}
+	}
+	return e
+}
+
+func resourceNotFound(tableName string) error {
+	return &APIError{Code: ErrResourceNotFound.Code, Message: "Requested resource not found: Table: " + tableName + " not found", StatusCode: 400}
+}
+
+func validationError(message string) error {
+	return &APIError{Code: ErrValidation.Code, Message: message, StatusCode: 400}
+}
+
+func conditionalCheckFailed() error {
+	return &APIError{Code: ErrConditionalCheckFailed.Code, Message: "The conditional request failed", StatusCode: 400}
+}
@@ -0,0 +1,1157 @@
+package dynamodb
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file parses and evaluates DynamoDB's condition, filter, key
+// condition, update and projection expressions for the memory backend.
+
+// exprContext resolves the placeholders of the expressions in one request
+// and tracks which were used, since DynamoDB rejects requests that define
+// placeholders no expression refers to.
+type exprContext struct {
+	names      map[string]string
+	values     map[string]AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newExprContext(names map[string]string, values map[string]AttributeValue) *exprContext {
+	return &exprContext{names: names, values: values, usedNames: make(map[string]bool), usedValues: make(map[string]bool)}
+}
+
+// unused returns an error naming any placeholder that was defined but not
+// used.
+func (c *exprContext) unused() error {
+	var names, values []string
+	for n := range c.names {
+		if !c.usedNames[n] {
+			names = append(names, n)
+		}
+	}
+	for v := range c.values {
+		if !c.usedValues[v] {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(values)
+	if len(names) > 0 {
+		return validationError("Value provided in ExpressionAttributeNames unused in expressions: keys: {" + strings.Join(names, ", ") + "}")
+	}
+	if len(values) > 0 {
+		return validationError("Value provided in ExpressionAttributeValues unused in expressions: keys: {" + strings.Join(values, ", ") + "}")
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenName   // #name
+	tokenValue  // :value
+	tokenNumber // a list index
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func isIdentRune(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '#' || r == ':':
+			j := i + 1
+			for j < len(rs) && isIdentRune(rs[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("Syntax error; token: %q", string(r))
+			}
+			kind := tokenName
+			if r == ':' {
+				kind = tokenValue
+			}
+			tokens = append(tokens, token{kind, string(rs[i:j])})
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenNumber, string(rs[i:j])})
+			i = j
+		case isIdentRune(r):
+			j := i
+			for j < len(rs) && isIdentRune(rs[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, string(rs[i:j])})
+			i = j
+		default:
+			if i+1 < len(rs) {
+				if two := string(rs[i : i+2]); two == "<>" || two == "<=" || two == ">=" {
+					tokens = append(tokens, token{tokenPunct, two})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("()[],.=<>+-", r) {
+				return nil, fmt.Errorf("Invalid character encountered; character: %q", string(r))
+			}
+			tokens = append(tokens, token{tokenPunct, string(r)})
+			i++
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+// parser is a recursive descent parser over the tokens of one expression.
+// Its methods return zero values once err is set, so callers need only
+// check err at the end.
+type parser struct {
+	tokens []token
+	pos    int
+	ctx    *exprContext
+	err    error
+}
+
+func newParser(expression string, ctx *exprContext) *parser {
+	tokens, err := lex(expression)
+	return &parser{tokens: tokens, ctx: ctx, err: err}
+}
+
+func (p *parser) peek() token {
+	if p.err != nil {
+		return token{kind: tokenEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+// keyword reports whether the next token is the case insensitive keyword
+// k, consuming it if so.
+func (p *parser) keyword(k string) bool {
+	if t := p.peek(); t.kind == tokenIdent && strings.EqualFold(t.text, k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// punct reports whether the next token is s, consuming it if so.
+func (p *parser) punct(s string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(s string) {
+	if !p.punct(s) {
+		p.fail("Syntax error; token: %q, expected %q", p.peek().text, s)
+	}
+}
+
+func (p *parser) end() {
+	if t := p.peek(); t.kind != tokenEOF {
+		p.fail("Syntax error; token: %q", t.text)
+	}
+}
+
+type pathElement struct {
+	name  string
+	index int // used when name is ""
+}
+
+// docPath is an attribute path such as a.b[1].
+type docPath []pathElement
+
+func (d docPath) String() string {
+	var b strings.Builder
+	for i, e := range d {
+		if e.name == "" {
+			fmt.Fprintf(&b, "[%d]", e.index)
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(e.name)
+	}
+	return b.String()
+}
+
+func (p *parser) pathName() string {
+	t := p.next()
+	switch t.kind {
+	case tokenIdent:
+		return t.text
+	case tokenName:
+		name, ok := p.ctx.names[t.text]
+		if !ok {
+			p.fail("An expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		p.ctx.usedNames[t.text] = true
+		return name
+	}
+	p.fail("Syntax error; token: %q, expected an attribute name", t.text)
+	return ""
+}
+
+func (p *parser) path() docPath {
+	d := docPath{{name: p.pathName()}}
+	for p.err == nil {
+		switch {
+		case p.punct("."):
+			d = append(d, pathElement{name: p.pathName()})
+		case p.punct("["):
+			t := p.next()
+			i, err := strconv.Atoi(t.text)
+			if t.kind != tokenNumber || err != nil {
+				p.fail("Syntax error; token: %q, expected a list index", t.text)
+			}
+			p.expect("]")
+			d = append(d, pathElement{index: i})
+		default:
+			return d
+		}
+	}
+	return d
+}
+
+func (p *parser) paths() []docPath {
+	paths := []docPath{p.path()}
+	for p.err == nil && p.punct(",") {
+		paths = append(paths, p.path())
+	}
+	return paths
+}
+
+// operand is a path, value or function within an expression. It
+// evaluates to false if it refers to an attribute that does not exist.
+type operand interface {
+	eval(item Item) (AttributeValue, bool, error)
+}
+
+type pathOperand docPath
+
+func (o pathOperand) eval(item Item) (AttributeValue, bool, error) {
+	v, ok := getPath(item, docPath(o))
+	return v, ok, nil
+}
+
+type valueOperand struct{ v AttributeValue }
+
+func (o valueOperand) eval(Item) (AttributeValue, bool, error) { return o.v, true, nil }
+
+type sizeOperand docPath
+
+func (o sizeOperand) eval(item Item) (AttributeValue, bool, error) {
+	v, ok := getPath(item, docPath(o))
+	if !ok {
+		return AttributeValue{}, false, nil
+	}
+	n := 0
+	switch v.Type() {
+	case "S", "N":
+		n = len(v.s)
+	case "B":
+		n = len(v.b)
+	case "SS", "NS":
+		n = len(v.ss)
+	case "BS":
+		n = len(v.bs)
+	case "L":
+		n = len(v.l)
+	case "M":
+		n = len(v.m)
+	default:
+		return AttributeValue{}, false, nil
+	}
+	return IntValue(int64(n)), true, nil
+}
+
+type ifNotExistsOperand struct {
+	path  docPath
+	value operand
+}
+
+func (o ifNotExistsOperand) eval(item Item) (AttributeValue, bool, error) {
+	if v, ok := getPath(item, o.path); ok {
+		return v, true, nil
+	}
+	return o.value.eval(item)
+}
+
+type listAppendOperand struct{ a, b operand }
+
+func (o listAppendOperand) eval(item Item) (AttributeValue, bool, error) {
+	a, okA, err := o.a.eval(item)
+	if err != nil {
+		return a, false, err
+	}
+	b, okB, err := o.b.eval(item)
+	if err != nil {
+		return b, false, err
+	}
+	if !okA || !okB {
+		return AttributeValue{}, false, validationError("The provided expression refers to an attribute that does not exist in the item")
+	}
+	if a.Type() != "L" || b.Type() != "L" {
+		return AttributeValue{}, false, validationError("An operand in the update expression has an incorrect data type")
+	}
+	return ListValue(append(append([]AttributeValue{}, a.l...), b.l...)...), true, nil
+}
+
+type arithmeticOperand struct {
+	op   string
+	a, b operand
+}
+
+func (o arithmeticOperand) eval(item Item) (AttributeValue, bool, error) {
+	a, okA, err := o.a.eval(item)
+	if err != nil {
+		return a, false, err
+	}
+	b, okB, err := o.b.eval(item)
+	if err != nil {
+		return b, false, err
+	}
+	if !okA || !okB {
+		return AttributeValue{}, false, validationError("The provided expression refers to an attribute that does not exist in the item")
+	}
+	x, okX := parseNumber(a)
+	y, okY := parseNumber(b)
+	if !okX || !okY {
+		return AttributeValue{}, false, validationError("An operand in the update expression has an incorrect data type")
+	}
+	if o.op == "+" {
+		return formatNumber(x.Add(x, y)), true, nil
+	}
+	return formatNumber(x.Sub(x, y)), true, nil
+}
+
+func parseNumber(v AttributeValue) (*big.Rat, bool) {
+	if v.Type() != "N" {
+		return nil, false
+	}
+	return new(big.Rat).SetString(v.s)
+}
+
+func formatNumber(r *big.Rat) AttributeValue {
+	if r.IsInt() {
+		return NumberValue(r.Num().String())
+	}
+	s := strings.TrimRight(r.FloatString(38), "0")
+	return NumberValue(strings.TrimSuffix(s, "."))
+}
+
+// operand parses a path, a value placeholder or size(path). In updates,
+// it also accepts if_not_exists, list_append and, unless inner, + and -.
+func (p *parser) operand(update, inner bool) operand {
+	var o operand
+	t := p.peek()
+	switch {
+	case t.kind == tokenValue:
+		p.next()
+		v, ok := p.ctx.values[t.text]
+		if !ok {
+			p.fail("An expression attribute value used in expression is not defined; attribute value: %s", t.text)
+		}
+		p.ctx.usedValues[t.text] = true
+		o = valueOperand{v}
+	case t.kind == tokenIdent && p.tokens[p.pos+1].text == "(":
+		p.next()
+		p.expect("(")
+		switch {
+		case t.text == "size":
+			o = sizeOperand(p.path())
+		case t.text == "if_not_exists" && update:
+			path := p.path()
+			p.expect(",")
+			o = ifNotExistsOperand{path, p.operand(update, true)}
+		case t.text == "list_append" && update:
+			a := p.operand(update, true)
+			p.expect(",")
+			o = listAppendOperand{a, p.operand(update, true)}
+		default:
+			p.fail("Invalid function name; function: %s", t.text)
+		}
+		p.expect(")")
+	default:
+		o = pathOperand(p.path())
+	}
+	if update && !inner {
+		if t := p.peek(); t.kind == tokenPunct && (t.text == "+" || t.text == "-") {
+			p.next()
+			o = arithmeticOperand{t.text, o, p.operand(update, true)}
+		}
+	}
+	return o
+}
+
+// condition is a parsed condition, filter or key condition expression.
+type condition interface {
+	eval(item Item) bool
+}
+
+type compareCondition struct {
+	op   string
+	a, b operand
+}
+
+func (c compareCondition) eval(item Item) bool {
+	a, okA, _ := c.a.eval(item)
+	b, okB, _ := c.b.eval(item)
+	if !okA || !okB {
+		return c.op == "<>" && okA != okB
+	}
+	switch c.op {
+	case "=":
+		return a.Equal(b)
+	case "<>":
+		return !a.Equal(b)
+	}
+	n, ok := compareValues(a, b)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "<":
+		return n < 0
+	case "<=":
+		return n <= 0
+	case ">":
+		return n > 0
+	}
+	return n >= 0
+}
+
+// compareValues orders two S, N or B values of the same type.
+func compareValues(a, b AttributeValue) (int, bool) {
+	if a.Type() != b.Type() {
+		return 0, false
+	}
+	switch a.Type() {
+	case "S":
+		return strings.Compare(a.s, b.s), true
+	case "N":
+		x, okX := parseNumber(a)
+		y, okY := parseNumber(b)
+		if !okX || !okY {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case "B":
+		return bytes.Compare(a.b, b.b), true
+	}
+	return 0, false
+}
+
+type betweenCondition struct{ a, low, high operand }
+
+func (c betweenCondition) eval(item Item) bool {
+	return compareCondition{">=", c.a, c.low}.eval(item) && compareCondition{"<=", c.a, c.high}.eval(item)
+}
+
+type inCondition struct {
+	a          operand
+	candidates []operand
+}
+
+func (c inCondition) eval(item Item) bool {
+	for _, candidate := range c.candidates {
+		if (compareCondition{"=", c.a, candidate}).eval(item) {
+			return true
+		}
+	}
+	return false
+}
+
+type functionCondition struct {
+	name string
+	path docPath
+	arg  operand
+}
+
+func (c functionCondition) eval(item Item) bool {
+	v, exists := getPath(item, c.path)
+	switch c.name {
+	case "attribute_exists":
+		return exists
+	case "attribute_not_exists":
+		return !exists
+	}
+	arg, ok, _ := c.arg.eval(item)
+	if !exists || !ok {
+		return false
+	}
+	switch c.name {
+	case "attribute_type":
+		t, ok := arg.AsString()
+		return ok && v.Type() == t
+	case "begins_with":
+		switch {
+		case v.Type() == "S" && arg.Type() == "S":
+			return strings.HasPrefix(v.s, arg.s)
+		case v.Type() == "B" && arg.Type() == "B":
+			return bytes.HasPrefix(v.b, arg.b)
+		}
+		return false
+	}
+	// contains
+	switch v.Type() {
+	case "S":
+		return arg.Type() == "S" && strings.Contains(v.s, arg.s)
+	case "SS":
+		return arg.Type() == "S" && v.containsElement(arg)
+	case "NS":
+		return arg.Type() == "N" && v.containsElement(arg)
+	case "BS":
+		return arg.Type() == "B" && v.containsElement(arg)
+	case "L":
+		for _, e := range v.l {
+			if e.Equal(arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsElement reports whether the set v has a member equal to the
+// scalar e.
+func (v AttributeValue) containsElement(e AttributeValue) bool {
+	for _, member := range v.members() {
+		if member.Equal(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// members returns the elements of a set as scalar values.
+func (v AttributeValue) members() []AttributeValue {
+	var members []AttributeValue
+	switch v.Type() {
+	case "SS":
+		for _, s := range v.ss {
+			members = append(members, StringValue(s))
+		}
+	case "NS":
+		for _, n := range v.ss {
+			members = append(members, NumberValue(n))
+		}
+	case "BS":
+		for _, b := range v.bs {
+			members = append(members, BinaryValue(b))
+		}
+	}
+	return members
+}
+
+type andCondition struct{ a, b condition }
+
+func (c andCondition) eval(item Item) bool { return c.a.eval(item) && c.b.eval(item) }
+
+type orCondition struct{ a, b condition }
+
+func (c orCondition) eval(item Item) bool { return c.a.eval(item) || c.b.eval(item) }
+
+type notCondition struct{ c condition }
+
+func (c notCondition) eval(item Item) bool { return !c.c.eval(item) }
+
+func (p *parser) condition() condition {
+	c := p.andCondition()
+	for p.err == nil && p.keyword("OR") {
+		c = orCondition{c, p.andCondition()}
+	}
+	return c
+}
+
+func (p *parser) andCondition() condition {
+	c := p.notCondition()
+	for p.err == nil && p.keyword("AND") {
+		c = andCondition{c, p.notCondition()}
+	}
+	return c
+}
+
+func (p *parser) notCondition() condition {
+	if p.keyword("NOT") {
+		return notCondition{p.notCondition()}
+	}
+	return p.primaryCondition()
+}
+
+var conditionFunctions = map[string]int{
+	"attribute_exists":     1,
+	"attribute_not_exists": 1,
+	"attribute_type":       2,
+	"begins_with":          2,
+	"contains":             2,
+}
+
+func (p *parser) primaryCondition() condition {
+	if p.punct("(") {
+		c := p.condition()
+		p.expect(")")
+		return c
+	}
+	if t := p.peek(); t.kind == tokenIdent && p.tokens[p.pos+1].text == "(" {
+		if arity, ok := conditionFunctions[t.text]; ok {
+			p.next()
+			p.expect("(")
+			c := functionCondition{name: t.text, path: p.path()}
+			if arity == 2 {
+				p.expect(",")
+				c.arg = p.operand(false, true)
+			}
+			p.expect(")")
+			return c
+		}
+	}
+	a := p.operand(false, true)
+	switch t := p.peek(); {
+	case t.kind == tokenPunct && (t.text == "=" || t.text == "<>" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next()
+		return compareCondition{t.text, a, p.operand(false, true)}
+	case p.keyword("BETWEEN"):
+		low := p.operand(false, true)
+		if !p.keyword("AND") {
+			p.fail("Syntax error; token: %q, expected AND", p.peek().text)
+		}
+		return betweenCondition{a, low, p.operand(false, true)}
+	case p.keyword("IN"):
+		p.expect("(")
+		c := inCondition{a: a, candidates: []operand{p.operand(false, true)}}
+		for p.err == nil && p.punct(",") {
+			c.candidates = append(c.candidates, p.operand(false, true))
+		}
+		p.expect(")")
+		if len(c.candidates) > 100 {
+			p.fail("Too many operands for IN")
+		}
+		return c
+	}
+	p.fail("Syntax error; token: %q, expected a comparison", p.peek().text)
+	return nil
+}
+
+// parseCondition parses a condition, filter or key condition expression;
+// what names it in error messages.
+func parseCondition(what, expression string, ctx *exprContext) (condition, error) {
+	p := newParser(expression, ctx)
+	c := p.condition()
+	p.end()
+	if p.err != nil {
+		return nil, validationError("Invalid " + what + ": " + p.err.Error())
+	}
+	return c, nil
+}
+
+func parseProjection(expression string, ctx *exprContext) ([]docPath, error) {
+	p := newParser(expression, ctx)
+	paths := p.paths()
+	p.end()
+	if p.err != nil {
+		return nil, validationError("Invalid ProjectionExpression: " + p.err.Error())
+	}
+	return paths, nil
+}
+
+type setAction struct {
+	path  docPath
+	value operand
+}
+
+type setValueAction struct {
+	path  docPath
+	value AttributeValue
+}
+
+// update is a parsed update expression.
+type update struct {
+	set    []setAction
+	remove []docPath
+	add    []setValueAction
+	delete []setValueAction
+}
+
+func parseUpdate(expression string, ctx *exprContext) (*update, error) {
+	p := newParser(expression, ctx)
+	u := &update{}
+	seen := make(map[string]bool)
+	for p.err == nil && p.peek().kind != tokenEOF {
+		clause := strings.ToUpper(p.next().text)
+		if seen[clause] {
+			p.fail("The %s section can only be used once in an update expression", clause)
+		}
+		seen[clause] = true
+		for {
+			switch clause {
+			case "SET":
+				path := p.path()
+				p.expect("=")
+				u.set = append(u.set, setAction{path, p.operand(true, false)})
+			case "REMOVE":
+				u.remove = append(u.remove, p.path())
+			case "ADD", "DELETE":
+				path := p.path()
+				t := p.next()
+				v, ok := ctx.values[t.text]
+				if t.kind != tokenValue || !ok {
+					p.fail("Syntax error; token: %q, expected a value", t.text)
+				}
+				ctx.usedValues[t.text] = true
+				if clause == "ADD" {
+					u.add = append(u.add, setValueAction{path, v})
+				} else {
+					u.delete = append(u.delete, setValueAction{path, v})
+				}
+			default:
+				p.fail("Syntax error; token: %q", clause)
+			}
+			if p.err != nil || !p.punct(",") {
+				break
+			}
+		}
+	}
+	if p.err == nil && len(seen) == 0 {
+		p.fail("The expression can not be empty")
+	}
+	if p.err != nil {
+		return nil, validationError("Invalid UpdateExpression: " + p.err.Error())
+	}
+	return u, u.checkOverlap()
+}
+
+// paths returns every path u writes to.
+func (u *update) paths() []docPath {
+	var paths []docPath
+	for _, a := range u.set {
+		paths = append(paths, a.path)
+	}
+	paths = append(paths, u.remove...)
+	for _, a := range u.add {
+		paths = append(paths, a.path)
+	}
+	for _, a := range u.delete {
+		paths = append(paths, a.path)
+	}
+	return paths
+}
+
+func (u *update) checkOverlap() error {
+	paths := u.paths()
+	for i, a := range paths {
+		for _, b := range paths[i+1:] {
+			if overlaps(a, b) {
+				return validationError(fmt.Sprintf("Invalid UpdateExpression: Two document paths overlap with each other; must remove or rewrite one of these paths; path one: [%s], path two: [%s]", a, b))
+			}
+		}
+	}
+	return nil
+}
+
+// pathLess orders paths element by element, with later list indexes
+// first.
+func pathLess(a, b docPath) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch x, y := a[i], b[i]; {
+		case x.name != y.name:
+			return x.name < y.name
+		case x.index != y.index:
+			return x.index > y.index
+		}
+	}
+	return len(a) < len(b)
+}
+
+func overlaps(a, b docPath) bool {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the result of applying u to item, leaving item unchanged.
+// Every operand is evaluated against item as it was before the update.
+func (u *update) apply(item Item) (Item, error) {
+	type write struct {
+		path  docPath
+		value AttributeValue
+	}
+	var writes []write
+	for _, a := range u.set {
+		v, ok, err := a.value.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, validationError("The provided expression refers to an attribute that does not exist in the item")
+		}
+		writes = append(writes, write{a.path, v})
+	}
+	for _, a := range u.add {
+		v, err := addValues(item, a.path, a.value)
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, write{a.path, v})
+	}
+	var removes []docPath
+	for _, a := range u.delete {
+		v, err := deleteValues(item, a.path, a.value)
+		if err != nil {
+			return nil, err
+		}
+		if v.IsZero() {
+			removes = append(removes, a.path)
+		} else {
+			writes = append(writes, write{a.path, v})
+		}
+	}
+
+	root := MapValue(item)
+	var err error
+	for _, w := range writes {
+		if root, err = setPath(root, w.path, w.value); err != nil {
+			return nil, err
+		}
+	}
+	// Remove later list elements first so that indexes refer to the item
+	// as it was.
+	removes = append(removes, u.remove...)
+	sort.Slice(removes, func(i, j int) bool { return pathLess(removes[i], removes[j]) })
+	for _, path := range removes {
+		root = removePath(root, path)
+	}
+	return Item(root.m), nil
+}
+
+// addValues returns the result of ADDing v to the attribute at path.
+func addValues(item Item, path docPath, v AttributeValue) (AttributeValue, error) {
+	old, exists := getPath(item, path)
+	switch v.Type() {
+	case "N":
+		if !exists {
+			return v, nil
+		}
+		x, okX := parseNumber(old)
+		y, okY := parseNumber(v)
+		if okX && okY {
+			return formatNumber(x.Add(x, y)), nil
+		}
+	case "SS", "NS", "BS":
+		if !exists {
+			return v, nil
+		}
+		if old.Type() == v.Type() {
+			members := old.members()
+			for _, m := range v.members() {
+				if !old.containsElement(m) {
+					members = append(members, m)
+				}
+			}
+			return setOf(v.Type(), members), nil
+		}
+	}
+	return AttributeValue{}, validationError("An operand in the update expression has an incorrect data type")
+}
+
+// deleteValues returns the set at path less the members of v, or the zero
+// AttributeValue if none are left.
+func deleteValues(item Item, path docPath, v AttributeValue) (AttributeValue, error) {
+	old, exists := getPath(item, path)
+	if v.Type() != "SS" && v.Type() != "NS" && v.Type() != "BS" || exists && old.Type() != v.Type() {
+		return AttributeValue{}, validationError("An operand in the update expression has an incorrect data type")
+	}
+	var members []AttributeValue
+	for _, m := range old.members() {
+		if !v.containsElement(m) {
+			members = append(members, m)
+		}
+	}
+	if len(members) == 0 {
+		return AttributeValue{}, nil
+	}
+	return setOf(v.Type(), members), nil
+}
+
+func setOf(t string, members []AttributeValue) AttributeValue {
+	v := AttributeValue{typ: t}
+	for _, m := range members {
+		if t == "BS" {
+			v.bs = append(v.bs, m.b)
+		} else {
+			v.ss = append(v.ss, m.s)
+		}
+	}
+	return v
+}
+
+func getPath(item Item, path docPath) (AttributeValue, bool) {
+	v := MapValue(item)
+	for _, e := range path {
+		switch {
+		case e.name != "" && v.Type() == "M":
+			var ok bool
+			if v, ok = v.m[e.name]; !ok {
+				return AttributeValue{}, false
+			}
+		case e.name == "" && v.Type() == "L" && e.index < len(v.l):
+			v = v.l[e.index]
+		default:
+			return AttributeValue{}, false
+		}
+	}
+	return v, true
+}
+
+// setPath returns a copy of root with the value at path set to v. The
+// parent of path must exist; an index past the end of a list appends.
+func setPath(root AttributeValue, path docPath, v AttributeValue) (AttributeValue, error) {
+	e := path[0]
+	invalid := validationError("The document path provided in the update expression is invalid for update")
+	switch {
+	case e.name != "" && root.Type() == "M":
+		m := make(map[string]AttributeValue, len(root.m)+1)
+		for k, x := range root.m {
+			m[k] = x
+		}
+		if len(path) == 1 {
+			m[e.name] = v
+		} else {
+			child, ok := m[e.name]
+			if !ok {
+				return root, invalid
+			}
+			var err error
+			if m[e.name], err = setPath(child, path[1:], v); err != nil {
+				return root, err
+			}
+		}
+		return MapValue(m), nil
+	case e.name == "" && root.Type() == "L":
+		l := append([]AttributeValue{}, root.l...)
+		switch {
+		case len(path) == 1 && e.index >= len(l):
+			l = append(l, v)
+		case len(path) == 1:
+			l[e.index] = v
+		case e.index >= len(l):
+			return root, invalid
+		default:
+			var err error
+			if l[e.index], err = setPath(l[e.index], path[1:], v); err != nil {
+				return root, err
+			}
+		}
+		return ListValue(l...), nil
+	}
+	return root, invalid
+}
+
+// removePath returns a copy of root without the value at path, or root
+// itself if there is none.
+func removePath(root AttributeValue, path docPath) AttributeValue {
+	e := path[0]
+	switch {
+	case e.name != "" && root.Type() == "M":
+		child, ok := root.m[e.name]
+		if !ok {
+			return root
+		}
+		m := make(map[string]AttributeValue, len(root.m))
+		for k, x := range root.m {
+			m[k] = x
+		}
+		if len(path) == 1 {
+			delete(m, e.name)
+		} else {
+			m[e.name] = removePath(child, path[1:])
+		}
+		return MapValue(m)
+	case e.name == "" && root.Type() == "L" && e.index < len(root.l):
+		l := append([]AttributeValue{}, root.l...)
+		if len(path) == 1 {
+			l = append(l[:e.index], l[e.index+1:]...)
+		} else {
+			l[e.index] = removePath(l[e.index], path[1:])
+		}
+		return ListValue(l...)
+	}
+	return root
+}
+
+// projectPaths returns the parts of item at paths. Elements picked out of
+// a list are returned in a list of their own, in the order requested.
+func projectPaths(item Item, paths []docPath) Item {
+	result := MapValue(Item{})
+	for _, path := range paths {
+		if v, ok := getPath(item, path); ok {
+			result = insertPath(result, path, v)
+		}
+	}
+	return Item(result.m)
+}
+
+func insertPath(root AttributeValue, path docPath, v AttributeValue) AttributeValue {
+	if len(path) == 0 {
+		return v
+	}
+	e := path[0]
+	if e.name == "" {
+		l := append([]AttributeValue{}, root.l...)
+		return ListValue(append(l, insertPath(AttributeValue{}, path[1:], v))...)
+	}
+	m := make(map[string]AttributeValue, len(root.m)+1)
+	for k, x := range root.m {
+		m[k] = x
+	}
+	m[e.name] = insertPath(m[e.name], path[1:], v)
+	return MapValue(m)
+}
+
+func and(a, b condition) condition {
+	if a == nil {
+		return b
+	}
+	return andCondition{a, b}
+}
+
+// expectedCondition converts the legacy Expected parameter to a condition.
+func expectedCondition(expected map[string]ExpectedAttributeValue) (condition, error) {
+	var c condition
+	for _, name := range sortedNames(expected) {
+		e, path := expected[name], docPath{{name: name}}
+		switch {
+		case e.Exists != nil && !*e.Exists && e.Value.IsZero():
+			c = and(c, functionCondition{name: "attribute_not_exists", path: path})
+		case (e.Exists == nil || *e.Exists) && !e.Value.IsZero():
+			c = and(c, compareCondition{"=", pathOperand(path), valueOperand{e.Value}})
+		default:
+			return nil, validationError("One or more parameter values were invalid: Value must be provided when Exists is true and must not be provided when it is false for Attribute: " + name)
+		}
+	}
+	return c, nil
+}
+
+// legacyConditions converts the legacy KeyConditions and ScanFilter
+// parameters to a condition.
+func legacyConditions(conditions map[string]Condition) (condition, error) {
+	var c condition
+	for _, name := range sortedNames(conditions) {
+		lc, path := conditions[name], docPath{{name: name}}
+		values := make([]operand, len(lc.AttributeValueList))
+		for i, v := range lc.AttributeValueList {
+			values[i] = valueOperand{v}
+		}
+		arity := 1
+		var term condition
+		switch lc.ComparisonOperator {
+		case "EQ", "NE", "LE", "LT", "GE", "GT":
+			op := map[string]string{"EQ": "=", "NE": "<>", "LE": "<=", "LT": "<", "GE": ">=", "GT": ">"}[lc.ComparisonOperator]
+			if len(values) == 1 {
+				term = compareCondition{op, pathOperand(path), values[0]}
+			}
+		case "NULL", "NOT_NULL":
+			arity = 0
+			term = functionCondition{name: "attribute_exists", path: path}
+			if lc.ComparisonOperator == "NULL" {
+				term = functionCondition{name: "attribute_not_exists", path: path}
+			}
+		case "CONTAINS", "NOT_CONTAINS", "BEGINS_WITH":
+			if len(values) == 1 {
+				term = functionCondition{name: strings.ToLower(strings.TrimPrefix(lc.ComparisonOperator, "NOT_")), path: path, arg: values[0]}
+				if strings.HasPrefix(lc.ComparisonOperator, "NOT_") {
+					term = notCondition{term}
+				}
+			}
+		case "IN":
+			arity = -1
+			if len(values) > 0 {
+				term = inCondition{pathOperand(path), values}
+			}
+		case "BETWEEN":
+			arity = 2
+			if len(values) == 2 {
+				term = betweenCondition{pathOperand(path), values[0], values[1]}
+			}
+		default:
+			return nil, validationError("Unsupported ComparisonOperator " + lc.ComparisonOperator + " for Attribute: " + name)
+		}
+		if arity >= 0 && len(values) != arity || term == nil {
+			return nil, validationError("One or more parameter values were invalid: Invalid number of argument(s) for the " + lc.ComparisonOperator + " ComparisonOperator")
+		}
+		c = and(c, term)
+	}
+	return c, nil
+}
+
+// attributeUpdates converts the legacy AttributeUpdates parameter to an
+// update.
+func attributeUpdates(updates map[string]AttributeValueUpdate) (*update, error) {
+	u := &update{}
+	for _, name := range sortedNames(updates) {
+		a, path := updates[name], docPath{{name: name}}
+		switch a.Action {
+		case "", "PUT":
+			if a.Value.IsZero() {
+				return nil, validationError("One or more parameter values were invalid: Only DELETE action is allowed when no attribute value is specified")
+			}
+			u.set = append(u.set, setAction{path, valueOperand{a.Value}})
+		case "DELETE":
+			if a.Value.IsZero() {
+				u.remove = append(u.remove, path)
+			} else {
+				u.delete = append(u.delete, setValueAction{path, a.Value})
+			}
+		case "ADD":
+			u.add = append(u.add, setValueAction{path, a.Value})
+		default:
+			return nil, validationError("Unsupported Action " + a.Action + " for Attribute: " + name)
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,367 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expression holds the expressions built by an ExpressionBuilder together
+// with the placeholders they refer to, ready to be copied into the options
+// of a request.
+type Expression struct {
+	Condition    string
+	Filter       string
+	KeyCondition string
+	Projection   string
+	Update       string
+	Names        map[string]string
+	Values       map[string]AttributeValue
+}
+
+// ExpressionBuilder builds an Expression from typed conditions, updates and
+// projections, substituting placeholders for every attribute name and value
+// so that reserved words and special characters never need escaping.
+type ExpressionBuilder struct {
+	condition    *ConditionBuilder
+	filter       *ConditionBuilder
+	keyCondition *ConditionBuilder
+	update       *UpdateBuilder
+	projection   []NameOperand
+}
+
+func (b ExpressionBuilder) WithCondition(c ConditionBuilder) ExpressionBuilder {
+	b.condition = &c
+	return b
+}
+
+func (b ExpressionBuilder) WithFilter(c ConditionBuilder) ExpressionBuilder {
+	b.filter = &c
+	return b
+}
+
+func (b ExpressionBuilder) WithKeyCondition(c ConditionBuilder) ExpressionBuilder {
+	b.keyCondition = &c
+	return b
+}
+
+func (b ExpressionBuilder) WithUpdate(u UpdateBuilder) ExpressionBuilder {
+	b.update = &u
+	return b
+}
+
+func (b ExpressionBuilder) WithProjection(names ...NameOperand) ExpressionBuilder {
+	b.projection = names
+	return b
+}
+
+// Build renders the expressions. Placeholders are numbered in a fixed
+// order, so building the same expressions always gives the same result.
+func (b ExpressionBuilder) Build() (Expression, error) {
+	var e Expression
+	p := &placeholders{}
+	if b.keyCondition != nil {
+		e.KeyCondition = b.keyCondition.render(p)
+	}
+	if b.condition != nil {
+		e.Condition = b.condition.render(p)
+	}
+	if b.filter != nil {
+		e.Filter = b.filter.render(p)
+	}
+	if b.update != nil {
+		e.Update = b.update.render(p)
+	}
+	if b.projection != nil {
+		if len(b.projection) == 0 {
+			p.fail(errors.New("projection has no attributes"))
+		}
+		paths := make([]string, len(b.projection))
+		for i, name := range b.projection {
+			paths[i] = name.render(p)
+		}
+		e.Projection = strings.Join(paths, ", ")
+	}
+	if p.err != nil {
+		return Expression{}, p.err
+	}
+	if e.Condition == "" && e.Filter == "" && e.KeyCondition == "" && e.Projection == "" && e.Update == "" {
+		return Expression{}, errors.New("dynamodb: expression builder is empty")
+	}
+	e.Names, e.Values = p.names, p.values
+	return e, nil
+}
+
+// placeholders allocates "#nN" and ":vN" placeholders while an Expression
+// is rendered, and records the first error met.
+type placeholders struct {
+	names  map[string]string // placeholder to name
+	byName map[string]string // name to placeholder
+	values map[string]AttributeValue
+	err    error
+}
+
+func (p *placeholders) name(name string) string {
+	if ph, ok := p.byName[name]; ok {
+		return ph
+	}
+	if p.names == nil {
+		p.names, p.byName = make(map[string]string), make(map[string]string)
+	}
+	ph := "#n" + strconv.Itoa(len(p.names))
+	p.names[ph], p.byName[name] = name, ph
+	return ph
+}
+
+func (p *placeholders) value(v AttributeValue) string {
+	if v.IsZero() {
+		p.fail(errors.New("value has no data type set"))
+	}
+	if p.values == nil {
+		p.values = make(map[string]AttributeValue)
+	}
+	ph := ":v" + strconv.Itoa(len(p.values))
+	p.values[ph] = v
+	return ph
+}
+
+func (p *placeholders) fail(err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("dynamodb: invalid expression: %w", err)
+	}
+}
+
+// Operand is an attribute, a value or a function of them within an
+// expression.
+type Operand interface {
+	render(p *placeholders) string
+}
+
+// NameOperand is an attribute path such as "Tags" or "Address.Lines[0]".
+type NameOperand struct {
+	path string
+}
+
+// Name returns the attribute at path: names separated by dots, each
+// optionally followed by list indexes in brackets.
+func Name(path string) NameOperand { return NameOperand{path} }
+
+func (n NameOperand) render(p *placeholders) string {
+	var b strings.Builder
+	for i, element := range strings.Split(n.path, ".") {
+		name, indexes := element, ""
+		if j := strings.IndexByte(element, '['); j >= 0 {
+			name, indexes = element[:j], element[j:]
+		}
+		if name == "" || !validIndexes(indexes) {
+			p.fail(fmt.Errorf("malformed attribute path %q", n.path))
+			return ""
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(p.name(name))
+		b.WriteString(indexes)
+	}
+	return b.String()
+}
+
+// validIndexes reports whether s is a possibly empty run of "[N]".
+func validIndexes(s string) bool {
+	for s != "" {
+		end := strings.IndexByte(s, ']')
+		if s[0] != '[' || end < 2 {
+			return false
+		}
+		if _, err := strconv.ParseUint(s[1:end], 10, 32); err != nil {
+			return false
+		}
+		s = s[end+1:]
+	}
+	return true
+}
+
+// ValueOperand is a literal value.
+type ValueOperand struct {
+	value AttributeValue
+}
+
+// Value returns v as an operand.
+func Value(v AttributeValue) ValueOperand { return ValueOperand{v} }
+
+func (v ValueOperand) render(p *placeholders) string { return p.value(v.value) }
+
+type functionOperand struct {
+	format   string
+	operands []Operand
+}
+
+func (f functionOperand) render(p *placeholders) string {
+	args := make([]interface{}, len(f.operands))
+	for i, o := range f.operands {
+		args[i] = o.render(p)
+	}
+	return fmt.Sprintf(f.format, args...)
+}
+
+// Size returns the size of the attribute at name.
+func Size(name NameOperand) Operand { return functionOperand{"size(%s)", []Operand{name}} }
+
+// Plus returns a + b, for use in an update.
+func Plus(a, b Operand) Operand { return functionOperand{"%s + %s", []Operand{a, b}} }
+
+// Minus returns a - b, for use in an update.
+func Minus(a, b Operand) Operand { return functionOperand{"%s - %s", []Operand{a, b}} }
+
+// IfNotExists returns the attribute at name, or value if it does not
+// exist, for use in an update.
+func IfNotExists(name NameOperand, value Operand) Operand {
+	return functionOperand{"if_not_exists(%s, %s)", []Operand{name, value}}
+}
+
+// ListAppend returns the concatenation of lists a and b, for use in an
+// update.
+func ListAppend(a, b Operand) Operand {
+	return functionOperand{"list_append(%s, %s)", []Operand{a, b}}
+}
+
+// ConditionBuilder is a condition, filter or key condition.
+type ConditionBuilder struct {
+	fn func(p *placeholders) string
+}
+
+func (c ConditionBuilder) render(p *placeholders) string {
+	if c.fn == nil {
+		p.fail(errors.New("empty condition"))
+		return ""
+	}
+	return c.fn(p)
+}
+
+func compare(operator string, a, b Operand) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"%s " + operator + " %s", []Operand{a, b}}.render}
+}
+
+func Equal(a, b Operand) ConditionBuilder            { return compare("=", a, b) }
+func NotEqual(a, b Operand) ConditionBuilder         { return compare("<>", a, b) }
+func LessThan(a, b Operand) ConditionBuilder         { return compare("<", a, b) }
+func LessThanEqual(a, b Operand) ConditionBuilder    { return compare("<=", a, b) }
+func GreaterThan(a, b Operand) ConditionBuilder      { return compare(">", a, b) }
+func GreaterThanEqual(a, b Operand) ConditionBuilder { return compare(">=", a, b) }
+
+// Between is true if low <= a <= high.
+func Between(a, low, high Operand) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"%s BETWEEN %s AND %s", []Operand{a, low, high}}.render}
+}
+
+// In is true if a equals any of candidates.
+func In(a Operand, candidates ...Operand) ConditionBuilder {
+	return ConditionBuilder{func(p *placeholders) string {
+		if len(candidates) == 0 {
+			p.fail(errors.New("IN has no candidates"))
+		}
+		list := make([]string, len(candidates))
+		for i, c := range candidates {
+			list[i] = c.render(p)
+		}
+		return a.render(p) + " IN (" + strings.Join(list, ", ") + ")"
+	}}
+}
+
+func AttributeExists(name NameOperand) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"attribute_exists(%s)", []Operand{name}}.render}
+}
+
+func AttributeNotExists(name NameOperand) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"attribute_not_exists(%s)", []Operand{name}}.render}
+}
+
+// AttributeType is true if the attribute at name has the data type t, such
+// as "S" or "NULL".
+func AttributeType(name NameOperand, t string) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"attribute_type(%s, %s)", []Operand{name, Value(StringValue(t))}}.render}
+}
+
+func BeginsWith(name NameOperand, prefix string) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"begins_with(%s, %s)", []Operand{name, Value(StringValue(prefix))}}.render}
+}
+
+// Contains is true if the string at name contains operand as a substring,
+// or the set or list at name contains it as an element.
+func Contains(name NameOperand, operand Operand) ConditionBuilder {
+	return ConditionBuilder{functionOperand{"contains(%s, %s)", []Operand{name, operand}}.render}
+}
+
+func And(conditions ...ConditionBuilder) ConditionBuilder { return join("AND", conditions) }
+
+func Or(conditions ...ConditionBuilder) ConditionBuilder { return join("OR", conditions) }
+
+func Not(c ConditionBuilder) ConditionBuilder {
+	return ConditionBuilder{func(p *placeholders) string { return "NOT (" + c.render(p) + ")" }}
+}
+
+func join(operator string, conditions []ConditionBuilder) ConditionBuilder {
+	return ConditionBuilder{func(p *placeholders) string {
+		if len(conditions) == 0 {
+			p.fail(fmt.Errorf("%s has no conditions", operator))
+		}
+		parts := make([]string, len(conditions))
+		for i, c := range conditions {
+			parts[i] = "(" + c.render(p) + ")"
+		}
+		return strings.Join(parts, " "+operator+" ")
+	}}
+}
+
+// UpdateBuilder collects the actions of an update expression. Its methods
+// return a new UpdateBuilder, leaving the receiver unchanged.
+type UpdateBuilder struct {
+	actions [4][]func(p *placeholders) string // SET, REMOVE, ADD, DELETE
+}
+
+var updateClauses = [4]string{"SET", "REMOVE", "ADD", "DELETE"}
+
+func (u UpdateBuilder) with(clause int, action func(p *placeholders) string) UpdateBuilder {
+	actions := u.actions[clause]
+	u.actions[clause] = append(actions[:len(actions):len(actions)], action)
+	return u
+}
+
+// Set sets the attribute at name to value.
+func (u UpdateBuilder) Set(name NameOperand, value Operand) UpdateBuilder {
+	return u.with(0, functionOperand{"%s = %s", []Operand{name, value}}.render)
+}
+
+// Remove removes the attribute at name.
+func (u UpdateBuilder) Remove(name NameOperand) UpdateBuilder {
+	return u.with(1, name.render)
+}
+
+// Add adds value to the number at name, or its elements to the set at name.
+func (u UpdateBuilder) Add(name NameOperand, value ValueOperand) UpdateBuilder {
+	return u.with(2, functionOperand{"%s %s", []Operand{name, value}}.render)
+}
+
+// Delete removes the elements of value from the set at name.
+func (u UpdateBuilder) Delete(name NameOperand, value ValueOperand) UpdateBuilder {
+	return u.with(3, functionOperand{"%s %s", []Operand{name, value}}.render)
+}
+
+func (u UpdateBuilder) render(p *placeholders) string {
+	var clauses []string
+	for i, actions := range u.actions {
+		if len(actions) == 0 {
+			continue
+		}
+		rendered := make([]string, len(actions))
+		for j, action := range actions {
+			rendered[j] = action(p)
+		}
+		clauses = append(clauses, updateClauses[i]+" "+strings.Join(rendered, ", "))
+	}
+	if len(clauses) == 0 {
+		p.fail(errors.New("update has no actions"))
+	}
+	return strings.Join(clauses, " ")
+}
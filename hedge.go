@@ -0,0 +1,117 @@
+package dynamodb
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hedging makes GetItem and Query send a second, identical request when the
+// first has not answered within a delay, and use whichever answers first.
+// The other request is canceled.
+type Hedging struct {
+	// Delay before the second request. If 0, the delay is Percentile of
+	// the latencies of recent hedged reads, but at least MinDelay. Reads
+	// are not hedged while the delay is 0.
+	Delay      time.Duration
+	Percentile float64 // 0 means 0.95
+	MinDelay   time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// hedgingSamples is how many recent latencies a Hedging remembers.
+const hedgingSamples = 256
+
+func (h *Hedging) delay() time.Duration {
+	if h.Delay > 0 {
+		return h.Delay
+	}
+	h.mu.Lock()
+	sorted := append([]time.Duration(nil), h.samples...)
+	h.mu.Unlock()
+	if len(sorted) < 20 {
+		return h.MinDelay
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p := h.Percentile
+	if p == 0 {
+		p = 0.95
+	}
+	d := sorted[int(p*float64(len(sorted)-1))]
+	if d < h.MinDelay {
+		d = h.MinDelay
+	}
+	return d
+}
+
+func (h *Hedging) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < hedgingSamples {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % hedgingSamples
+}
+
+// hedgedActions is the set of idempotent read actions that Hedging
+// applies to.
+var hedgedActions = map[string]bool{"GetItem": true, "Query": true}
+
+// hedge makes one attempt at action like send, but also sends a second,
+// identical request if the first has not answered within h's delay. It
+// sits below the rate limiter, circuit breaker and metrics, which see a
+// single attempt whichever request wins.
+func (db *dynamo) hedge(ctx context.Context, h *Hedging, action, tableName string, attempt int, body []byte) ([]byte, error) {
+	delay := h.delay()
+	start := time.Now()
+	if delay <= 0 {
+		// Until there are enough samples to choose a delay, still
+		// measure reads so that hedging can begin.
+		response, err := db.send(ctx, action, tableName, attempt, body)
+		if err == nil {
+			h.observe(time.Since(start))
+		}
+		return response, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		response []byte
+		err      error
+	}
+	results := make(chan result, 2)
+	run := func() {
+		response, err := db.send(ctx, action, tableName, attempt, body)
+		results <- result{response, err}
+	}
+	go run()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	outstanding, hedged := 1, false
+	for {
+		select {
+		case r := <-results:
+			outstanding--
+			if r.err == nil {
+				h.observe(time.Since(start))
+				return r.response, nil
+			}
+			if outstanding == 0 {
+				return nil, r.err
+			}
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				outstanding++
+				go run()
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ListAllTables returns the name of every table, following
+// LastEvaluatedTableName from page to page.
+func ListAllTables(ctx context.Context, db DynamoDB) ([]string, error) {
+	var names []string
+	options := &ListTablesOptions{}
+	for {
+		r, err := db.ListTablesWithContext(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, r.TableNames...)
+		if r.LastEvaluatedTableName == "" {
+			return names, nil
+		}
+		options.ExclusiveStartTableName = r.LastEvaluatedTableName
+	}
+}
+
+// The most keys a BatchGetItem, and writes a BatchWriteItem, may carry.
+const (
+	MaxBatchGetKeys    = 100
+	MaxBatchWriteItems = 25
+)
+
+// ErrUnprocessed is reported for batch entries that DynamoDB still had not
+// processed when the retry policy gave up.
+var ErrUnprocessed = errors.New("dynamodb: batch entry left unprocessed")
+
+// BatchOptions configures BatchGetAll and BatchWriteAll.
+type BatchOptions struct {
+	Concurrency int         // batches in flight at once; 0 means 4
+	RetryPolicy RetryPolicy // paces resubmission of unprocessed entries; nil means DefaultRetryPolicy
+}
+
+// BatchFailure is an entry that BatchGetAll or BatchWriteAll could not
+// process.
+type BatchFailure struct {
+	TableName string
+	Key       Key           // set by BatchGetAll
+	Write     *WriteRequest // set by BatchWriteAll
+	Err       error
+}
+
+// BatchError lists every entry that failed; the rest succeeded.
+type BatchError struct {
+	Failures []BatchFailure
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("dynamodb: %d batch entries failed, first: %v", len(e.Failures), e.Failures[0].Err)
+}
+
+// Unwrap returns the distinct causes, so errors.Is finds any of them.
+func (e *BatchError) Unwrap() []error {
+	var errs []error
+	seen := make(map[error]bool)
+	for _, f := range e.Failures {
+		if !seen[f.Err] {
+			seen[f.Err] = true
+			errs = append(errs, f.Err)
+		}
+	}
+	return errs
+}
+
+// BatchGetAll reads every key in requestItems, splitting them into
+// BatchGetItem calls of at most MaxBatchGetKeys and resubmitting unprocessed
+// keys with backoff. It returns the items found by table and, if any key
+// could not be read, a *BatchError naming each one.
+func BatchGetAll(ctx context.Context, db DynamoDB, requestItems map[string]KeysAndAttributes, options *BatchOptions) (map[string][]Item, error) {
+	type entry struct {
+		table string
+		key   Key
+	}
+	var entries []entry
+	for _, table := range sortedNames(requestItems) {
+		for _, key := range requestItems[table].Keys {
+			entries = append(entries, entry{table, key})
+		}
+	}
+
+	var mu sync.Mutex
+	results := make(map[string][]Item)
+	failures := &BatchError{}
+	fail := func(pending map[string]KeysAndAttributes, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, table := range sortedNames(pending) {
+			for _, key := range pending[table].Keys {
+				failures.Failures = append(failures.Failures, BatchFailure{TableName: table, Key: key, Err: err})
+			}
+		}
+	}
+
+	options.run(len(entries), MaxBatchGetKeys, func(i, j int) {
+		pending := make(map[string]KeysAndAttributes)
+		for _, e := range entries[i:j] {
+			k, ok := pending[e.table]
+			if !ok {
+				k = requestItems[e.table]
+				k.Keys = nil
+			}
+			k.Keys = append(k.Keys, e.key)
+			pending[e.table] = k
+		}
+		var previous time.Duration
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			r, err := db.BatchGetItemWithContext(ctx, pending, nil)
+			if err != nil {
+				fail(pending, err)
+				return
+			}
+			mu.Lock()
+			for table, items := range r.Responses {
+				results[table] = append(results[table], items...)
+			}
+			mu.Unlock()
+			pending = make(map[string]KeysAndAttributes)
+			for table, k := range r.UnprocessedKeys {
+				if len(k.Keys) > 0 {
+					pending[table] = k
+				}
+			}
+			if len(pending) == 0 {
+				return
+			}
+			if previous, err = options.backoff(ctx, attempt, start, previous); err != nil {
+				fail(pending, err)
+				return
+			}
+		}
+	})
+
+	if len(failures.Failures) > 0 {
+		return results, failures
+	}
+	return results, nil
+}
+
+// BatchWriteAll applies every write in requestItems, splitting them into
+// BatchWriteItem calls of at most MaxBatchWriteItems and resubmitting
+// unprocessed writes with backoff. If any write could not be applied it
+// returns a *BatchError naming each one.
+func BatchWriteAll(ctx context.Context, db DynamoDB, requestItems map[string][]WriteRequest, options *BatchOptions) error {
+	type entry struct {
+		table string
+		write WriteRequest
+	}
+	var entries []entry
+	for _, table := range sortedNames(requestItems) {
+		for _, w := range requestItems[table] {
+			entries = append(entries, entry{table, w})
+		}
+	}
+
+	var mu sync.Mutex
+	failures := &BatchError{}
+	fail := func(pending map[string][]WriteRequest, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, table := range sortedNames(pending) {
+			for i := range pending[table] {
+				failures.Failures = append(failures.Failures, BatchFailure{TableName: table, Write: &pending[table][i], Err: err})
+			}
+		}
+	}
+
+	options.run(len(entries), MaxBatchWriteItems, func(i, j int) {
+		pending := make(map[string][]WriteRequest)
+		for _, e := range entries[i:j] {
+			pending[e.table] = append(pending[e.table], e.write)
+		}
+		var previous time.Duration
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			r, err := db.BatchWriteItemWithContext(ctx, pending, nil)
+			if err != nil {
+				fail(pending, err)
+				return
+			}
+			pending = make(map[string][]WriteRequest)
+			for table, writes := range r.UnprocessedItems {
+				if len(writes) > 0 {
+					pending[table] = writes
+				}
+			}
+			if len(pending) == 0 {
+				return
+			}
+			if previous, err = options.backoff(ctx, attempt, start, previous); err != nil {
+				fail(pending, err)
+				return
+			}
+		}
+	})
+
+	if len(failures.Failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// run calls batch for each consecutive range of at most size of n entries,
+// with at most o.Concurrency calls in flight, and waits for them all.
+func (o *BatchOptions) run(n, size int, batch func(i, j int)) {
+	concurrency := 4
+	if o != nil && o.Concurrency > 0 {
+		concurrency = o.Concurrency
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i += size {
+		j := i + size
+		if j > n {
+			j = n
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i, j int) {
+			defer func() { <-sem; wg.Done() }()
+			batch(i, j)
+		}(i, j)
+	}
+	wg.Wait()
+}
+
+// backoff waits before attempt+1 resubmits unprocessed entries. It returns
+// the delay waited, ErrUnprocessed if the retry policy gives up, or the
+// context's error if it ends first.
+func (o *BatchOptions) backoff(ctx context.Context, attempt int, start time.Time, previous time.Duration) (time.Duration, error) {
+	policy := DefaultRetryPolicy
+	if o != nil && o.RetryPolicy != nil {
+		policy = o.RetryPolicy
+	}
+	// DynamoDB leaves entries unprocessed when they would exceed the
+	// table's throughput, so they are retried as a throttle would be.
+	delay, ok := policy.Retry(attempt, time.Since(start), previous, ErrProvisionedThroughputExceeded)
+	if !ok {
+		return 0, ErrUnprocessed
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	tables := make([]string, 0, len(m))
+	for table := range m {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
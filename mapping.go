@@ -1,10 +1,9 @@
 package dynamodb
 
 import (
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"reflect"
 	"strconv"
@@ -19,18 +18,45 @@ type Mapping interface {
 	FromItem(tableName string, item Item) interface{}
 }
 
-type mapping map[string]struct {
+// ItemDecoder is implemented by Mappings that can report why an item does
+// not fit the type registered for its table. The clients of this package
+// implement it.
+type ItemDecoder interface {
+	FromItemErr(tableName string, item Item) (interface{}, error)
+}
+
+// FromItemErr is like m.FromItem but returns an error instead of panicking
+// when item does not fit the type registered for tableName.
+func FromItemErr(m Mapping, tableName string, item Item) (v interface{}, err error) {
+	if d, ok := m.(ItemDecoder); ok {
+		return d.FromItemErr(tableName, item)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			v, err = nil, fmt.Errorf("dynamodb: %v", p)
+		}
+	}()
+	return m.FromItem(tableName, item), nil
+}
+
+type mapping struct {
+	tables map[string]mappedTable
+	logger *slog.Logger
+}
+
+type mappedTable struct {
 	TableDescription *TableDescription
 	TableType        reflect.Type
 }
 
+func newMapping(logger *slog.Logger) mapping {
+	return mapping{tables: make(map[string]mappedTable), logger: logger}
+}
+
 func (m mapping) Register(tableName string, i interface{}) (*TableDescription, error) {
 	tableType := reflect.TypeOf(i).Elem()
 	if t, err := m.tableFor(tableName, tableType); err == nil {
-		m[tableName] = struct {
-			TableDescription *TableDescription
-			TableType        reflect.Type
-		}{TableDescription: t, TableType: tableType}
+		m.tables[tableName] = mappedTable{TableDescription: t, TableType: tableType}
 		return t, nil
 	} else {
 		return nil, err
@@ -46,25 +72,16 @@ func (m mapping) tableFor(tableName string, tableType reflect.Type) (*TableDescr
 
 	for i := 0; i < tableType.NumField(); i++ {
 		f := tableType.Field(i)
-		attributeType := ""
-		switch f.Type {
-		case urlType:
-			attributeType = "S"
-		default:
-			switch f.Type.Kind() {
-			case reflect.String:
-				attributeType = "S"
-			case reflect.Int, reflect.Int64:
-				attributeType = "N"
-			case reflect.Slice:
-				attributeType = "B"
-			default:
-				return nil, errors.New("attribute type not supported")
-			}
+		attributeType := attributeTypeOf(f.Type)
+		if attributeType == "" {
+			return nil, errors.New("attribute type not supported")
 		}
 		name := tableType.Field(i).Name
 
 		tag := f.Tag.Get("db")
+		if (tag == "HASH" || tag == "RANGE") && attributeType != "S" && attributeType != "N" && attributeType != "B" {
+			return nil, errors.New("key attributes must be strings, numbers or binary")
+		}
 		if tag == "HASH" {
 			attributeDefinitions = append(attributeDefinitions, AttributeDefinition{name, attributeType})
 			primaryHash = &KeySchemaElement{name, "HASH"}
@@ -86,33 +103,139 @@ func (m mapping) tableFor(tableName string, tableType reflect.Type) (*TableDescr
 	return &TableDescription{TableName: tableName, KeySchema: keySchema, AttributeDefinitions: attributeDefinitions, ProvisionedThroughput: &provisionedThroughput}, nil
 }
 
-func (m mapping) ToItem(s interface{}) Item {
-	var it Item = make(map[string]AttributeValue)
-	sValue := reflect.ValueOf(s).Elem()
-	typeOfItem := sValue.Type()
-
-	for i := 0; i < sValue.NumField(); i++ {
-		f := sValue.Field(i)
-		name := typeOfItem.Field(i).Name
-		switch f.Type().Kind() {
+// attributeTypeOf returns the DynamoDB data type that fields of type t map
+// to, or "" if they cannot be mapped.
+func attributeTypeOf(t reflect.Type) string {
+	if t == urlType {
+		return "S"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "S"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "N"
+	case reflect.Bool:
+		return "BOOL"
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.Uint8:
+			return "B"
 		case reflect.String:
-			v := f.Interface().(string)
-			if v != "" {
-				it[name] = map[string]string{"S": v}
+			return "SS"
+		}
+	}
+	return ""
+}
+
+// toAttributeValue returns the AttributeValue for f, reporting false if f
+// is empty and should be left out of the item.
+func toAttributeValue(f reflect.Value) (AttributeValue, bool) {
+	switch attributeTypeOf(f.Type()) {
+	case "S":
+		if f.Type() == urlType {
+			if f.IsNil() {
+				return AttributeValue{}, false
 			}
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			s := strconv.FormatInt(f.Int(), 10)
-			it[name] = map[string]string{"N": s}
+			return StringValue(f.Interface().(*url.URL).String()), true
+		}
+		return StringValue(f.String()), f.Len() > 0
+	case "N":
+		switch f.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return NumberValue(strconv.FormatFloat(f.Float(), 'g', -1, f.Type().Bits())), true
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-			s := strconv.FormatUint(f.Uint(), 10)
-			it[name] = map[string]string{"N": s}
-		case reflect.Slice:
-			s := base64.StdEncoding.EncodeToString(f.Bytes())
-			it[name] = map[string]string{"B": s}
+			return NumberValue(strconv.FormatUint(f.Uint(), 10)), true
+		}
+		return IntValue(f.Int()), true
+	case "BOOL":
+		return BoolValue(f.Bool()), true
+	case "B":
+		return BinaryValue(f.Bytes()), true
+	case "SS":
+		return StringSetValue(f.Interface().([]string)...), f.Len() > 0
+	}
+	panic("attribute type not supported")
+}
+
+// fromAttributeValue stores v in f, returning an error if v's data type
+// does not fit f.
+func fromAttributeValue(f reflect.Value, v AttributeValue) error {
+	mismatch := fmt.Errorf("cannot store %s value in %v", v.Type(), f.Type())
+	switch attributeTypeOf(f.Type()) {
+	case "S":
+		s, ok := v.AsString()
+		if !ok {
+			return mismatch
+		}
+		if f.Type() == urlType {
+			u, err := url.Parse(s)
+			if err != nil {
+				return err
+			}
+			f.Set(reflect.ValueOf(u))
+		} else {
+			f.SetString(s)
+		}
+	case "N":
+		n, ok := v.AsNumber()
+		if !ok {
+			return mismatch
+		}
+		switch f.Kind() {
+		case reflect.Float32, reflect.Float64:
+			x, err := strconv.ParseFloat(n, f.Type().Bits())
+			if err != nil {
+				return err
+			}
+			f.SetFloat(x)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			x, err := strconv.ParseUint(n, 10, 64)
+			if err != nil || f.OverflowUint(x) {
+				return fmt.Errorf("%v does not fit in %v", n, f.Type())
+			}
+			f.SetUint(x)
 		default:
-			panic("attribute type not supported")
+			x, err := strconv.ParseInt(n, 10, 64)
+			if err != nil || f.OverflowInt(x) {
+				return fmt.Errorf("%v does not fit in %v", n, f.Type())
+			}
+			f.SetInt(x)
+		}
+	case "BOOL":
+		b, ok := v.AsBool()
+		if !ok {
+			return mismatch
+		}
+		f.SetBool(b)
+	case "B":
+		b, ok := v.AsBinary()
+		if !ok {
+			return mismatch
 		}
+		f.SetBytes(b)
+	case "SS":
+		ss, ok := v.AsStringSet()
+		if !ok {
+			return mismatch
+		}
+		f.Set(reflect.ValueOf(append([]string(nil), ss...)))
+	default:
+		return errors.New("attribute type not supported")
+	}
+	return nil
+}
 
+func (m mapping) ToItem(s interface{}) Item {
+	it := make(Item)
+	sValue := reflect.ValueOf(s).Elem()
+	typeOfItem := sValue.Type()
+
+	for i := 0; i < sValue.NumField(); i++ {
+		if v, ok := toAttributeValue(sValue.Field(i)); ok {
+			it[typeOfItem.Field(i).Name] = v
+		}
 	}
 	return it
 }
@@ -128,71 +251,43 @@ func (m mapping) ToKey(s interface{}) Key {
 		sf := sType.Field(i)
 		tag := sf.Tag.Get("db")
 		if tag == "HASH" || tag == "RANGE" {
-			fv := sValue.Field(i)
-			switch sf.Type {
-			case urlType:
-				u := fv.Interface().(*url.URL)
-				key[sf.Name] = AttributeValue{"S": u.String()}
-			default:
-				switch sf.Type.Kind() {
-				case reflect.String:
-					key[sf.Name] = AttributeValue{"S": fv.Interface().(string)}
-				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-					key[sf.Name] = AttributeValue{"N": strconv.FormatInt(fv.Int(), 10)}
-				case reflect.Slice:
-					s := base64.StdEncoding.EncodeToString(fv.Bytes())
-					key[sf.Name] = AttributeValue{"B": s}
-				default:
-					panic("attribute type not supported")
-				}
-			}
+			v, _ := toAttributeValue(sValue.Field(i))
+			key[sf.Name] = v
 		}
 	}
 	return key
 }
 
+// FromItem is like FromItemErr but panics on an error.
 func (m mapping) FromItem(tableName string, item Item) interface{} {
-	et := m[tableName].TableType
-	v := reflect.New(et)
-	v = v.Elem()
-	switch v.Kind() {
-	case reflect.Struct:
-		for kk, vv := range item {
-			if value, ok := vv["S"]; ok {
-				f := v.FieldByName(kk)
-				switch f.Type() {
-				case urlType:
-					log.Print("We have a URL!")
-					if u, err := url.Parse(value); err == nil {
-						f.Set(reflect.ValueOf(u))
-					}
-				default:
-					if f.CanSet() {
-						f.SetString(value)
-					} else {
-						log.Println("Warning: can't set:", kk)
-					}
-				}
-			}
-			if value, ok := vv["N"]; ok {
-				f := v.FieldByName(kk)
-				n, err := strconv.ParseInt(value, 10, 64)
-				if err != nil || f.OverflowInt(n) {
-					panic(fmt.Sprintf("%v %v\n", value, v.Type()))
-				}
-				f.SetInt(n)
-			}
-			if value, ok := vv["B"]; ok {
-				f := v.FieldByName(kk)
-				bytes, err := base64.StdEncoding.DecodeString(value)
-				if err != nil {
-					panic(fmt.Sprintf("%v %v\n", value, v.Type()))
-				}
-				f.SetBytes(bytes)
-			}
+	v, err := m.FromItemErr(tableName, item)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// FromItemErr returns a pointer to a new value of the type registered for
+// tableName, with its fields set from item. It fails if an attribute's data
+// type does not fit its field.
+func (m mapping) FromItemErr(tableName string, item Item) (interface{}, error) {
+	t, ok := m.tables[tableName]
+	if !ok {
+		return nil, fmt.Errorf("dynamodb: no type is registered for table %s", tableName)
+	}
+	v := reflect.New(t.TableType).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dynamodb: unsupported item type %v", t.TableType)
+	}
+	for kk, vv := range item {
+		f := v.FieldByName(kk)
+		if !f.IsValid() || !f.CanSet() {
+			m.logger.Warn("can't set attribute", "table", tableName, "attribute", kk)
+			continue
+		}
+		if err := fromAttributeValue(f, vv); err != nil {
+			return nil, fmt.Errorf("dynamodb: attribute %s of table %s: %w", kk, tableName, err)
 		}
-	default:
-		panic("Unsupported item type error")
 	}
-	return v.Addr().Interface()
+	return v.Addr().Interface(), nil
 }
@@ -1,129 +1,1395 @@
 package dynamodb
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-type items map[string]Item
+type table struct {
+	description TableDescription
+	items       map[string]Item
+}
 
 type memory struct {
 	mapping
-	tables map[string]items
+	mu     sync.Mutex
+	tables map[string]*table
+	tokens map[string]transactToken // by ClientRequestToken
 }
 
+// NewMemoryDB returns an in-memory implementation of DynamoDB, useful for
+// tests.
 func NewMemoryDB() DynamoDB {
-	return &memory{mapping: make(mapping)}
+	return NewMemoryDBWithConfig(Config{})
+}
+
+// NewMemoryDBWithConfig is like NewMemoryDB but logs to config.Logger; the
+// rest of config only applies to the HTTP client.
+func NewMemoryDBWithConfig(config Config) DynamoDB {
+	return &memory{mapping: newMapping(config.withDefaults().Logger), tables: make(map[string]*table)}
+}
+
+// table returns the named table; b.mu must be held.
+func (b *memory) table(tableName string) (*table, error) {
+	t, ok := b.tables[tableName]
+	if !ok {
+		return nil, resourceNotFound(tableName)
+	}
+	return t, nil
+}
+
+// keyString returns the primary key of item as a string identifying it
+// within t. Each part carries its data type and length, so that keys of
+// different types, or whose parts hold any bytes, never collide. Numbers
+// are canonicalized, so that "1" and "1.0" are the same key, as they are to
+// the expression evaluator.
+func (t *table) keyString(item map[string]AttributeValue) (string, error) {
+	var b strings.Builder
+	for _, k := range t.description.KeySchema {
+		v, ok := item[k.AttributeName]
+		if !ok {
+			return "", validationError("One of the required keys was not given a value")
+		}
+		if declared := t.attributeType(k.AttributeName); declared != "" && declared != v.Type() {
+			return "", validationError("One or more parameter values were invalid: Type mismatch for key " + k.AttributeName + " expected: " + declared + " actual: " + v.Type())
+		}
+		var part string
+		switch v.Type() {
+		case "S":
+			part = v.s
+		case "N":
+			n, ok := parseNumber(v)
+			if !ok {
+				return "", validationError("The parameter cannot be converted to a numeric value: " + v.s)
+			}
+			part = formatNumber(n).s
+		case "B":
+			part = string(v.b)
+		default:
+			return "", validationError("The provided key element does not match the schema")
+		}
+		b.WriteString(v.Type())
+		b.WriteString(strconv.Itoa(len(part)))
+		b.WriteByte(':')
+		b.WriteString(part)
+	}
+	return b.String(), nil
+}
+
+// key returns the key string of key, which must hold exactly the key
+// attributes of t.
+func (t *table) key(key Key) (string, error) {
+	pk, err := t.keyString(key)
+	if err != nil {
+		return "", err
+	}
+	if len(key) != len(t.description.KeySchema) {
+		return "", validationError("The provided key element does not match the schema")
+	}
+	return pk, nil
+}
+
+// attributeType returns the declared data type of the attribute name, or ""
+// if it has none.
+func (t *table) attributeType(name string) string {
+	for _, a := range t.description.AttributeDefinitions {
+		if a.AttributeName == name {
+			return a.AttributeType
+		}
+	}
+	return ""
+}
+
+// cloneItem returns a deep copy of item, so that the items a memory stores
+// share nothing with its callers.
+func cloneItem(item map[string]AttributeValue) Item {
+	if item == nil {
+		return nil
+	}
+	c := make(Item, len(item))
+	for k, v := range item {
+		c[k] = v.clone()
+	}
+	return c
+}
+
+// cloneItems returns deep copies of items.
+func cloneItems(items []Item) []Item {
+	if items == nil {
+		return nil
+	}
+	c := make([]Item, len(items))
+	for i, item := range items {
+		c[i] = cloneItem(item)
+	}
+	return c
+}
+
+// sortedKeys returns the keys of t's items in a stable order.
+func (t *table) sortedKeys() []string {
+	keys := make([]string, 0, len(t.items))
+	for k := range t.items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// keyOf returns the attributes of item that make up schema.
+func keyOf(item Item, schema []KeySchemaElement) Key {
+	key := make(Key)
+	for _, k := range schema {
+		if v, ok := item[k.AttributeName]; ok {
+			key[k.AttributeName] = v
+		}
+	}
+	return key
+}
+
+// index is the key schema and projection of a table or one of its
+// secondary indexes.
+type index struct {
+	schema     []KeySchemaElement
+	projection *Projection // nil for the table itself
+	global     bool
+}
+
+// index returns the named index of t, or t's own if indexName is empty.
+func (t *table) index(indexName string) (index, error) {
+	if indexName == "" {
+		return index{schema: t.description.KeySchema}, nil
+	}
+	for _, lsi := range t.description.LocalSecondaryIndexes {
+		if lsi.IndexName == indexName {
+			return index{schema: lsi.KeySchema, projection: lsi.Projection}, nil
+		}
+	}
+	for _, gsi := range t.description.GlobalSecondaryIndexes {
+		if gsi.IndexName == indexName {
+			return index{schema: gsi.KeySchema, projection: gsi.Projection, global: true}, nil
+		}
+	}
+	return index{}, validationError("The table does not have the specified index: " + indexName)
+}
+
+// project returns the attributes of item that i holds. Local indexes fetch
+// the attributes they do not project from the table, so only global
+// indexes leave any out.
+func (i index) project(item Item, tableSchema []KeySchemaElement) Item {
+	if !i.global || i.projection == nil || i.projection.ProjectionType == "ALL" {
+		return item
+	}
+	projected := Item(keyOf(item, tableSchema))
+	for k, v := range keyOf(item, i.schema) {
+		projected[k] = v
+	}
+	if i.projection.ProjectionType == "INCLUDE" {
+		for _, name := range i.projection.NonKeyAttributes {
+			if v, ok := item[name]; ok {
+				projected[name] = v
+			}
+		}
+	}
+	return projected
+}
+
+// hasKey reports whether item has every attribute of schema, and so
+// appears in an index with that schema.
+func hasKey(item Item, schema []KeySchemaElement) bool {
+	for _, k := range schema {
+		if _, ok := item[k.AttributeName]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkKeySchema checks that schema is a HASH key, optionally followed by
+// a RANGE key.
+func checkKeySchema(schema []KeySchemaElement) error {
+	if len(schema) == 0 || len(schema) > 2 || schema[0].KeyType != "HASH" || len(schema) == 2 && schema[1].KeyType != "RANGE" {
+		return validationError("The key schema must be a HASH key optionally followed by a RANGE key")
+	}
+	return nil
+}
+
+// hasIndex reports whether t has an index named indexName.
+func (t *table) hasIndex(indexName string) bool {
+	_, err := t.index(indexName)
+	return indexName != "" && err == nil
+}
+
+func globalSecondaryIndexDescription(indexName string, schema []KeySchemaElement, projection Projection, pt *ProvisionedThroughput) GlobalSecondaryIndexDescription {
+	d := GlobalSecondaryIndexDescription{IndexName: indexName, IndexStatus: "ACTIVE", KeySchema: schema, Projection: &projection}
+	if pt != nil {
+		d.ProvisionedThroughput = &ProvisionedThroughputDescription{ReadCapacityUnits: pt.ReadCapacityUnits, WriteCapacityUnits: pt.WriteCapacityUnits}
+	}
+	return d
+}
+
+// mixedParameters is returned for requests that use both expression and
+// legacy parameters.
+func mixedParameters(expression, legacy string) error {
+	return validationError("Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {" + legacy + "} Expression parameters: {" + expression + "}")
+}
+
+// writeCondition parses the condition a write must satisfy, or returns
+// nil if there is none.
+func writeCondition(expression string, expected map[string]ExpectedAttributeValue, exprs *exprContext) (condition, error) {
+	switch {
+	case expression != "" && expected != nil:
+		return nil, mixedParameters("ConditionExpression", "Expected")
+	case expression != "":
+		return parseCondition("ConditionExpression", expression, exprs)
+	case expected != nil:
+		return expectedCondition(expected)
+	}
+	return nil, nil
+}
+
+// filterCondition parses the filter a read applies, or returns nil if
+// there is none.
+func filterCondition(expression string, legacy map[string]Condition, exprs *exprContext) (condition, error) {
+	switch {
+	case expression != "" && legacy != nil:
+		return nil, mixedParameters("FilterExpression", "ScanFilter")
+	case expression != "":
+		return parseCondition("FilterExpression", expression, exprs)
+	case legacy != nil:
+		return legacyConditions(legacy)
+	}
+	return nil, nil
+}
+
+func checkCondition(c condition, item Item) error {
+	if c != nil && !c.eval(item) {
+		return conditionalCheckFailed()
+	}
+	return nil
+}
+
+// projection parses the attributes a read returns; nil means all of them.
+func projection(attributesToGet []string, expression string, exprs *exprContext) ([]docPath, error) {
+	switch {
+	case attributesToGet != nil && expression != "":
+		return nil, mixedParameters("ProjectionExpression", "AttributesToGet")
+	case expression != "":
+		return parseProjection(expression, exprs)
+	}
+	var paths []docPath
+	for _, name := range attributesToGet {
+		paths = append(paths, docPath{{name: name}})
+	}
+	return paths, nil
+}
+
+// project returns the parts of item at paths, or item itself if paths is
+// nil.
+func project(item Item, paths []docPath) Item {
+	if paths == nil {
+		return item
+	}
+	return projectPaths(item, paths)
+}
+
+func (t *table) describe() *TableDescription {
+	td := t.description
+	td.ItemCount = int64(len(t.items))
+	td.LocalSecondaryIndexes = append([]LocalSecondaryIndexDescription(nil), td.LocalSecondaryIndexes...)
+	for i := range td.LocalSecondaryIndexes {
+		td.LocalSecondaryIndexes[i].ItemCount = t.count(td.LocalSecondaryIndexes[i].KeySchema)
+	}
+	td.GlobalSecondaryIndexes = append([]GlobalSecondaryIndexDescription(nil), td.GlobalSecondaryIndexes...)
+	for i := range td.GlobalSecondaryIndexes {
+		td.GlobalSecondaryIndexes[i].ItemCount = t.count(td.GlobalSecondaryIndexes[i].KeySchema)
+	}
+	return &td
+}
+
+// count returns how many of t's items appear in an index with schema.
+func (t *table) count(schema []KeySchemaElement) int64 {
+	n := int64(0)
+	for _, item := range t.items {
+		if hasKey(item, schema) {
+			n++
+		}
+	}
+	return n
 }
 
 func (b *memory) BatchGetItem(requestedItems map[string]KeysAndAttributes, options *BatchGetItemOptions) (*BatchGetItemResult, error) {
-	return nil, errors.New("NYI")
+	return b.BatchGetItemWithContext(context.Background(), requestedItems, options)
+}
+
+func (b *memory) BatchGetItemWithContext(ctx context.Context, requestedItems map[string]KeysAndAttributes, options *BatchGetItemOptions) (*BatchGetItemResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, ka := range requestedItems {
+		n += len(ka.Keys)
+	}
+	if n == 0 || n > 100 {
+		return nil, validationError("Too many items requested for the BatchGetItem call")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := BatchGetItemResult{Responses: make(map[string][]Item), UnprocessedKeys: make(map[string]KeysAndAttributes)}
+	for tableName, ka := range requestedItems {
+		t, err := b.table(tableName)
+		if err != nil {
+			return nil, err
+		}
+		exprs := newExprContext(ka.ExpressionAttributeNames, nil)
+		paths, err := projection(ka.AttributesToGet, ka.ProjectionExpression, exprs)
+		if err != nil {
+			return nil, err
+		}
+		if err := exprs.unused(); err != nil {
+			return nil, err
+		}
+		items := []Item{}
+		for _, key := range ka.Keys {
+			pk, err := t.key(key)
+			if err != nil {
+				return nil, err
+			}
+			if item, ok := t.items[pk]; ok {
+				items = append(items, cloneItem(project(item, paths)))
+			}
+		}
+		r.Responses[tableName] = items
+	}
+	return &r, nil
 }
 
-func (b *memory) BatchWriteItem(requestedItems map[string]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error) {
-	return nil, errors.New("NYI")
+func (b *memory) BatchWriteItem(requestedItems map[string][]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error) {
+	return b.BatchWriteItemWithContext(context.Background(), requestedItems, options)
+}
+
+// BatchWriteItemWithContext validates every request before applying any,
+// so that a batch is applied atomically.
+func (b *memory) BatchWriteItemWithContext(ctx context.Context, requestedItems map[string][]WriteRequest, options *BatchWriteItemOptions) (*BatchWriteItemResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, requests := range requestedItems {
+		n += len(requests)
+	}
+	if n == 0 || n > 25 {
+		return nil, validationError("Too many items requested for the BatchWriteItem call")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	type write struct {
+		table *table
+		pk    string
+		item  Item // nil for deletes
+	}
+	var writes []write
+	seen := make(map[string]bool)
+	for tableName, requests := range requestedItems {
+		t, err := b.table(tableName)
+		if err != nil {
+			return nil, err
+		}
+		for _, request := range requests {
+			var w write
+			switch {
+			case request.PutRequest != nil && request.DeleteRequest == nil:
+				w.item = request.PutRequest.Item
+				w.pk, err = t.keyString(w.item)
+			case request.DeleteRequest != nil && request.PutRequest == nil:
+				w.pk, err = t.key(request.DeleteRequest.Key)
+			default:
+				err = validationError("Supplied AttributeValue has more than one datatypes set, must contain exactly one of the supported datatypes")
+			}
+			if err != nil {
+				return nil, err
+			}
+			if seen[tableName+"\x00"+w.pk] {
+				return nil, validationError("Provided list of item keys contains duplicates")
+			}
+			seen[tableName+"\x00"+w.pk] = true
+			w.table = t
+			writes = append(writes, w)
+		}
+	}
+	for _, w := range writes {
+		if w.item != nil {
+			w.table.items[w.pk] = cloneItem(w.item)
+		} else {
+			delete(w.table.items, w.pk)
+		}
+	}
+	return &BatchWriteItemResult{UnprocessedItems: make(map[string][]WriteRequest)}, nil
 }
 
 func (b *memory) CreateTable(tableName string, attributeDefinitions []AttributeDefinition, keySchema []KeySchemaElement, ProvisionedThroughput ProvisionedThroughput, options *CreateTableOptions) (*CreateTableResult, error) {
-	if b.tables == nil {
-		b.tables = make(map[string]items)
+	return b.CreateTableWithContext(context.Background(), tableName, attributeDefinitions, keySchema, ProvisionedThroughput, options)
+}
+
+func (b *memory) CreateTableWithContext(ctx context.Context, tableName string, attributeDefinitions []AttributeDefinition, keySchema []KeySchemaElement, provisionedThroughput ProvisionedThroughput, options *CreateTableOptions) (*CreateTableResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(keySchema) == 0 || keySchema[0].KeyType != "HASH" {
+		return nil, validationError("The key schema must start with a HASH key")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.tables[tableName]; ok {
+		return nil, &APIError{Code: ErrResourceInUse.Code, Message: "Table already exists: " + tableName, StatusCode: 400}
+	}
+	td := TableDescription{
+		AttributeDefinitions:  attributeDefinitions,
+		CreationDateTime:      DateTime(float64(time.Now().UnixNano()) / 1e9),
+		KeySchema:             keySchema,
+		ProvisionedThroughput: &ProvisionedThroughputDescription{ReadCapacityUnits: provisionedThroughput.ReadCapacityUnits, WriteCapacityUnits: provisionedThroughput.WriteCapacityUnits},
+		TableName:             tableName,
+		TableStatus:           "ACTIVE",
+	}
+	t := &table{description: td, items: make(map[string]Item)}
+	if options != nil {
+		for _, lsi := range options.LocalSecondaryIndexes {
+			if t.hasIndex(lsi.IndexName) {
+				return nil, validationError("Duplicate index name: " + lsi.IndexName)
+			}
+			projection := lsi.Projection
+			t.description.LocalSecondaryIndexes = append(t.description.LocalSecondaryIndexes, LocalSecondaryIndexDescription{IndexName: lsi.IndexName, KeySchema: lsi.KeySchema, Projection: &projection})
+		}
+		for _, gsi := range options.GlobalSecondaryIndexes {
+			if t.hasIndex(gsi.IndexName) {
+				return nil, validationError("Duplicate index name: " + gsi.IndexName)
+			}
+			if err := checkKeySchema(gsi.KeySchema); err != nil {
+				return nil, err
+			}
+			t.description.GlobalSecondaryIndexes = append(t.description.GlobalSecondaryIndexes, globalSecondaryIndexDescription(gsi.IndexName, gsi.KeySchema, gsi.Projection, gsi.ProvisionedThroughput))
+		}
 	}
-	b.tables[tableName] = make(items)
-	td := TableDescription{}
-	td.TableStatus = "ACTIVE"
-	return &CreateTableResult{TableDescription: &td}, nil
+	b.tables[tableName] = t
+	return &CreateTableResult{TableDescription: t.describe()}, nil
 }
 
 func (m *memory) UpdateItem(tableName string, key Key, options *UpdateItemOptions) (*UpdateItemResult, error) {
-	return nil, errors.New("NYI")
+	return m.UpdateItemWithContext(context.Background(), tableName, key, options)
+}
+
+func (m *memory) UpdateItemWithContext(ctx context.Context, tableName string, key Key, options *UpdateItemOptions) (*UpdateItemResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &UpdateItemOptions{}
+	}
+	if (options.ConditionExpression != "" || options.UpdateExpression != "") && (options.Expected != nil || options.AttributeUpdates != nil) {
+		return nil, mixedParameters("ConditionExpression, UpdateExpression", "Expected, AttributeUpdates")
+	}
+	exprs := newExprContext(options.ExpressionAttributeNames, options.ExpressionAttributeValues)
+	condition, err := writeCondition(options.ConditionExpression, options.Expected, exprs)
+	if err != nil {
+		return nil, err
+	}
+	u := &update{}
+	switch {
+	case options.UpdateExpression != "":
+		u, err = parseUpdate(options.UpdateExpression, exprs)
+	case options.AttributeUpdates != nil:
+		u, err = attributeUpdates(options.AttributeUpdates)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := exprs.unused(); err != nil {
+		return nil, err
+	}
+	switch options.ReturnValues {
+	case "", "NONE", "ALL_OLD", "UPDATED_OLD", "ALL_NEW", "UPDATED_NEW":
+	default:
+		return nil, validationError("Invalid ReturnValues: " + options.ReturnValues)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := t.updateKey(key, u)
+	if err != nil {
+		return nil, err
+	}
+	old, existed := t.items[pk]
+	if err := checkCondition(condition, old); err != nil {
+		return nil, err
+	}
+	item, err := updated(old, key, u)
+	if err != nil {
+		return nil, err
+	}
+	t.items[pk] = cloneItem(item)
+
+	r := UpdateItemResult{}
+	switch options.ReturnValues {
+	case "ALL_OLD":
+		if existed {
+			r.Attributes = cloneItem(old)
+		}
+	case "UPDATED_OLD":
+		if existed {
+			r.Attributes = cloneItem(projectPaths(old, u.paths()))
+		}
+	case "ALL_NEW":
+		r.Attributes = cloneItem(item)
+	case "UPDATED_NEW":
+		r.Attributes = cloneItem(projectPaths(item, u.paths()))
+	}
+	return &r, nil
+}
+
+// updateKey returns the key string of the item of t that u updates, which
+// must leave the attributes of key alone.
+func (t *table) updateKey(key Key, u *update) (string, error) {
+	pk, err := t.key(key)
+	if err != nil {
+		return "", err
+	}
+	for _, path := range u.paths() {
+		if _, ok := key[path[0].name]; ok {
+			return "", validationError("Cannot update attribute " + path[0].name + ". This attribute is part of the key")
+		}
+	}
+	return pk, nil
+}
+
+// updated returns old after u, where a nil old is an item holding only key.
+func updated(old Item, key Key, u *update) (Item, error) {
+	if old == nil {
+		old = make(Item)
+		for k, v := range key {
+			old[k] = v
+		}
+	}
+	return u.apply(old)
 }
 
 func (db *memory) UpdateTable(tableName string, provisionedThroughput ProvisionedThroughput, options *UpdateTableOptions) (*UpdateTableResult, error) {
-	return nil, errors.New("NYI")
+	return db.UpdateTableWithContext(context.Background(), tableName, provisionedThroughput, options)
+}
+
+func (db *memory) UpdateTableWithContext(ctx context.Context, tableName string, provisionedThroughput ProvisionedThroughput, options *UpdateTableOptions) (*UpdateTableResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &UpdateTableOptions{}
+	}
+	if provisionedThroughput == (ProvisionedThroughput{}) && len(options.GlobalSecondaryIndexUpdates) == 0 {
+		return nil, validationError("At least one of ProvisionedThroughput or GlobalSecondaryIndexUpdates is required")
+	}
+
+	// Work on a copy so that a bad update leaves the table unchanged.
+	updated := *t
+	td := &updated.description
+	td.GlobalSecondaryIndexes = append([]GlobalSecondaryIndexDescription(nil), td.GlobalSecondaryIndexes...)
+	td.AttributeDefinitions = append([]AttributeDefinition(nil), td.AttributeDefinitions...)
+	if provisionedThroughput != (ProvisionedThroughput{}) {
+		pt := *td.ProvisionedThroughput
+		pt.ReadCapacityUnits = provisionedThroughput.ReadCapacityUnits
+		pt.WriteCapacityUnits = provisionedThroughput.WriteCapacityUnits
+		td.ProvisionedThroughput = &pt
+	}
+	// find returns the position of the named global index in td.
+	find := func(indexName string) (int, error) {
+		for i, gsi := range td.GlobalSecondaryIndexes {
+			if gsi.IndexName == indexName {
+				return i, nil
+			}
+		}
+		return 0, &APIError{Code: ErrResourceNotFound.Code, Message: "Requested resource not found: Index: " + indexName + " not found", StatusCode: 400}
+	}
+	changes := 0
+	for _, u := range options.GlobalSecondaryIndexUpdates {
+		switch {
+		case u.Create != nil && u.Delete == nil && u.Update == nil:
+			changes++
+			if updated.hasIndex(u.Create.IndexName) {
+				return nil, validationError("Attempting to create an index which already exists: " + u.Create.IndexName)
+			}
+			if err := checkKeySchema(u.Create.KeySchema); err != nil {
+				return nil, err
+			}
+			td.GlobalSecondaryIndexes = append(td.GlobalSecondaryIndexes, globalSecondaryIndexDescription(u.Create.IndexName, u.Create.KeySchema, u.Create.Projection, u.Create.ProvisionedThroughput))
+		case u.Delete != nil && u.Create == nil && u.Update == nil:
+			changes++
+			i, err := find(u.Delete.IndexName)
+			if err != nil {
+				return nil, err
+			}
+			td.GlobalSecondaryIndexes = append(td.GlobalSecondaryIndexes[:i], td.GlobalSecondaryIndexes[i+1:]...)
+		case u.Update != nil && u.Create == nil && u.Delete == nil:
+			i, err := find(u.Update.IndexName)
+			if err != nil {
+				return nil, err
+			}
+			pt := ProvisionedThroughputDescription{}
+			if old := td.GlobalSecondaryIndexes[i].ProvisionedThroughput; old != nil {
+				pt = *old
+			}
+			pt.ReadCapacityUnits = u.Update.ProvisionedThroughput.ReadCapacityUnits
+			pt.WriteCapacityUnits = u.Update.ProvisionedThroughput.WriteCapacityUnits
+			td.GlobalSecondaryIndexes[i].ProvisionedThroughput = &pt
+		default:
+			return nil, validationError("One or more parameter values were invalid: exactly one of Create, Update and Delete must be set in a GlobalSecondaryIndexUpdate")
+		}
+	}
+	if changes > 1 {
+		return nil, validationError("Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table")
+	}
+	for _, a := range options.AttributeDefinitions {
+		defined := false
+		for _, b := range td.AttributeDefinitions {
+			defined = defined || a.AttributeName == b.AttributeName
+		}
+		if !defined {
+			td.AttributeDefinitions = append(td.AttributeDefinitions, a)
+		}
+	}
+	*t = updated
+	r := UpdateTableResult{TableDescription: t.describe()}
+	r.TableDescription.TableStatus = "UPDATING"
+	return &r, nil
 }
 
 func (db *memory) DescribeTable(tableName string, options *DescribeTableOptions) (*DescribeTableResult, error) {
+	return db.DescribeTableWithContext(context.Background(), tableName, options)
+}
 
-	td := TableDescription{}
-	td.TableStatus = "ACTIVE"
-	return &DescribeTableResult{Table: &td}, nil
+func (db *memory) DescribeTableWithContext(ctx context.Context, tableName string, options *DescribeTableOptions) (*DescribeTableResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	return &DescribeTableResult{Table: t.describe()}, nil
 }
 
 func (db *memory) DeleteTable(tableName string, options *DeleteTableOptions) (*DeleteTableResult, error) {
+	return db.DeleteTableWithContext(context.Background(), tableName, options)
+}
+
+func (db *memory) DeleteTableWithContext(ctx context.Context, tableName string, options *DeleteTableOptions) (*DeleteTableResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(tableName)
+	if err != nil {
+		return nil, err
+	}
 	delete(db.tables, tableName)
-	td := TableDescription{}
-	// TODO
-	return &DeleteTableResult{TableDescription: &td}, nil
+	td := t.describe()
+	td.TableStatus = "DELETING"
+	return &DeleteTableResult{TableDescription: td}, nil
 }
 
 func (b *memory) PutItem(tableName string, item Item, options *PutItemOptions) (*PutItemResult, error) {
-	if b.tables == nil {
-		return nil, errors.New("no tables")
+	return b.PutItemWithContext(context.Background(), tableName, item, options)
+}
+
+func (b *memory) PutItemWithContext(ctx context.Context, tableName string, item Item, options *PutItemOptions) (*PutItemResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	t, ok := b.tables[tableName]
-	if !ok {
-		return nil, errors.New("no such table")
+	if options == nil {
+		options = &PutItemOptions{}
 	}
-	pk := ""
-	hash := b.mapping[tableName].TableDescription.KeySchema[0]
-	m := item[hash.AttributeName]
-	if len(m) == 1 {
-		for _, v := range m {
-			pk = v
-		}
-	} else {
-		panic("boo")
+	exprs := newExprContext(options.ExpressionAttributeNames, options.ExpressionAttributeValues)
+	condition, err := writeCondition(options.ConditionExpression, options.Expected, exprs)
+	if err != nil {
+		return nil, err
+	}
+	if err := exprs.unused(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := t.keyString(item)
+	if err != nil {
+		return nil, err
+	}
+	old, existed := t.items[pk]
+	if err := checkCondition(condition, old); err != nil {
+		return nil, err
+	}
+	t.items[pk] = cloneItem(item)
+	r := PutItemResult{}
+	if existed && options.ReturnValues == "ALL_OLD" {
+		r.Attributes = cloneItem(old)
 	}
-	t[pk] = item
-	r := PutItemResult{} // TODO
 	return &r, nil
 }
 
 func (b *memory) DeleteItem(tableName string, key Key, options *DeleteItemOptions) (*DeleteItemResult, error) {
-	return nil, errors.New("NYI")
+	return b.DeleteItemWithContext(context.Background(), tableName, key, options)
+}
+
+func (b *memory) DeleteItemWithContext(ctx context.Context, tableName string, key Key, options *DeleteItemOptions) (*DeleteItemResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &DeleteItemOptions{}
+	}
+	exprs := newExprContext(options.ExpressionAttributeNames, options.ExpressionAttributeValues)
+	condition, err := writeCondition(options.ConditionExpression, options.Expected, exprs)
+	if err != nil {
+		return nil, err
+	}
+	if err := exprs.unused(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := t.key(key)
+	if err != nil {
+		return nil, err
+	}
+	old, existed := t.items[pk]
+	if err := checkCondition(condition, old); err != nil {
+		return nil, err
+	}
+	delete(t.items, pk)
+	r := DeleteItemResult{}
+	if existed && options.ReturnValues == "ALL_OLD" {
+		r.Attributes = old
+	}
+	return &r, nil
 }
 
 func (b *memory) GetItem(tableName string, key Key, options *GetItemOptions) (*GetItemResult, error) {
-	if b.tables == nil {
-		return nil, errors.New("no tables")
+	return b.GetItemWithContext(context.Background(), tableName, key, options)
+}
+
+func (b *memory) GetItemWithContext(ctx context.Context, tableName string, key Key, options *GetItemOptions) (*GetItemResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	t, ok := b.tables[tableName]
+	if options == nil {
+		options = &GetItemOptions{}
+	}
+	var attributesToGet []string
+	if options.AttributesToGet != nil {
+		attributesToGet = *options.AttributesToGet
+	}
+	exprs := newExprContext(options.ExpressionAttributeNames, nil)
+	paths, err := projection(attributesToGet, options.ProjectionExpression, exprs)
+	if err != nil {
+		return nil, err
+	}
+	if err := exprs.unused(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := t.key(key)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := t.items[pk]
 	if !ok {
-		return nil, errors.New("no such table")
+		return &GetItemResult{}, nil
 	}
+	i = cloneItem(project(i, paths))
+	return &GetItemResult{Item: &i}, nil
+}
 
-	pk := ""
-	hash := b.mapping[tableName].TableDescription.KeySchema[0]
-	m := key[hash.AttributeName]
-	if len(m) == 1 {
-		for _, v := range m {
-			pk = v
+func (b *memory) ListTables(options *ListTablesOptions) (*ListTablesResult, error) {
+	return b.ListTablesWithContext(context.Background(), options)
+}
+
+func (b *memory) ListTablesWithContext(ctx context.Context, options *ListTablesOptions) (*ListTablesResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &ListTablesOptions{}
+	}
+	limit := options.Limit
+	if limit < 0 || limit > 100 {
+		return nil, validationError("Limit must be between 1 and 100")
+	} else if limit == 0 {
+		limit = 100
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := []string{}
+	for name := range b.tables {
+		if name > options.ExclusiveStartTableName {
+			names = append(names, name)
 		}
-	} else {
-		panic("boo")
 	}
-	i := t[pk]
-	return &GetItemResult{Item: &i}, nil
+	sort.Strings(names)
+	r := ListTablesResult{TableNames: names}
+	if len(names) > limit {
+		r.TableNames = names[:limit]
+		r.LastEvaluatedTableName = names[limit-1]
+	}
+	return &r, nil
 }
 
-func (b *memory) ListTables(options *ListTablesOptions) (*ListTablesResult, error) {
-	return nil, errors.New("NYI")
+func (b *memory) Scan(tableName string, options *ScanOptions) (*ScanResult, error) {
+	return b.ScanWithContext(context.Background(), tableName, options)
 }
 
-func (b *memory) Scan(tableName string, options *ScanOptions) (scanResult *ScanResult, err error) {
-	if b.tables == nil {
-		return nil, errors.New("no tables")
+func (b *memory) ScanWithContext(ctx context.Context, tableName string, options *ScanOptions) (*ScanResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	t, ok := b.tables[tableName]
-	if !ok {
-		return nil, errors.New("no such table")
+	if options == nil {
+		options = &ScanOptions{}
+	}
+	exprs := newExprContext(options.ExpressionAttributeNames, options.ExpressionAttributeValues)
+	filter, err := filterCondition(options.FilterExpression, options.ScanFilter, exprs)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := projection(options.AttributesToGet, options.ProjectionExpression, exprs)
+	if err != nil {
+		return nil, err
+	}
+	if err := exprs.unused(); err != nil {
+		return nil, err
+	}
+	if options.Limit < 0 || options.TotalSegments < 0 || options.Segment < 0 || options.Segment > 0 && options.Segment >= options.TotalSegments {
+		return nil, validationError("Limit, Segment and TotalSegments must be non-negative and Segment less than TotalSegments")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	start := ""
+	if options.ExclusiveStartKey != nil {
+		if start, err = t.keyString(options.ExclusiveStartKey); err != nil {
+			return nil, err
+		}
+	}
+	var scanned []Item
+	for _, pk := range t.sortedKeys() {
+		if options.ExclusiveStartKey != nil && pk <= start {
+			continue
+		}
+		if options.TotalSegments > 0 {
+			h := fnv.New32a()
+			h.Write([]byte(pk))
+			if int(h.Sum32()%uint32(options.TotalSegments)) != options.Segment {
+				continue
+			}
+		}
+		scanned = append(scanned, t.items[pk])
 	}
-	var items []Item
-	for _, item := range t {
-		items = append(items, item)
+	r := ScanResult{}
+	if options.Limit > 0 && len(scanned) > options.Limit {
+		scanned = scanned[:options.Limit]
+		r.LastEvaluatedKey = keyOf(scanned[len(scanned)-1], t.description.KeySchema)
 	}
-	return &ScanResult{Count: len(t), ScannedCount: len(t), Items: items}, nil
+	r.ScannedCount = len(scanned)
+	r.Items, r.Count = filterItems(scanned, filter, paths, options.Select)
+	r.Items = cloneItems(r.Items)
+	r.LastEvaluatedKey = Key(cloneItem(r.LastEvaluatedKey))
+	return &r, nil
+}
+
+// filterItems returns the projections of the items that pass filter, and
+// how many there were; if sel is "COUNT" it only counts them.
+func filterItems(items []Item, filter condition, paths []docPath, sel string) ([]Item, int) {
+	var matched []Item
+	n := 0
+	for _, item := range items {
+		if filter != nil && !filter.eval(item) {
+			continue
+		}
+		n++
+		if sel != "COUNT" {
+			matched = append(matched, project(item, paths))
+		}
+	}
+	return matched, n
+}
+
+// queryKey checks that c is a valid key condition for schema: an equality
+// on the hash key, optionally with one comparison, BETWEEN or begins_with
+// on the range key. It returns the hash key's value.
+func queryKey(c condition, schema []KeySchemaElement) (AttributeValue, error) {
+	var terms []condition
+	var flatten func(c condition)
+	flatten = func(c condition) {
+		if and, ok := c.(andCondition); ok {
+			flatten(and.a)
+			flatten(and.b)
+		} else {
+			terms = append(terms, c)
+		}
+	}
+	flatten(c)
+
+	var hash AttributeValue
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		var path docPath
+		var value operand
+		operator := ""
+		switch term := term.(type) {
+		case compareCondition:
+			if p, ok := term.a.(pathOperand); ok && term.op != "<>" {
+				path, value, operator = docPath(p), term.b, term.op
+			}
+		case betweenCondition:
+			if p, ok := term.a.(pathOperand); ok {
+				path, value, operator = docPath(p), term.low, "BETWEEN"
+			}
+		case functionCondition:
+			if term.name == "begins_with" {
+				path, value, operator = term.path, term.arg, term.name
+			}
+		}
+		_, isValue := value.(valueOperand)
+		if operator == "" || !isValue || len(path) != 1 || seen[path[0].name] {
+			return hash, validationError("Query key condition not supported")
+		}
+		seen[path[0].name] = true
+		switch {
+		case path[0].name == schema[0].AttributeName && operator == "=":
+			hash = value.(valueOperand).v
+		case len(schema) > 1 && path[0].name == schema[1].AttributeName:
+		default:
+			return hash, validationError("Query key condition not supported")
+		}
+	}
+	if hash.IsZero() {
+		return hash, validationError("Query condition missed key schema element: " + schema[0].AttributeName)
+	}
+	return hash, nil
 }
 
 func (m *memory) Query(tableName string, options *QueryOptions) (*QueryResult, error) {
-	return nil, errors.New("NYI")
+	return m.QueryWithContext(context.Background(), tableName, options)
+}
+
+func (m *memory) QueryWithContext(ctx context.Context, tableName string, options *QueryOptions) (*QueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &QueryOptions{}
+	}
+	exprs := newExprContext(options.ExpressionAttributeNames, options.ExpressionAttributeValues)
+	var keyCondition condition
+	var err error
+	switch {
+	case options.KeyConditionExpression != "" && options.KeyConditions != nil:
+		return nil, mixedParameters("KeyConditionExpression", "KeyConditions")
+	case options.KeyConditionExpression != "":
+		keyCondition, err = parseCondition("KeyConditionExpression", options.KeyConditionExpression, exprs)
+	case options.KeyConditions != nil:
+		keyCondition, err = legacyConditions(options.KeyConditions)
+	default:
+		return nil, validationError("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	filter, err := filterCondition(options.FilterExpression, nil, exprs)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := projection(options.AttributesToGet, options.ProjectionExpression, exprs)
+	if err != nil {
+		return nil, err
+	}
+	if err := exprs.unused(); err != nil {
+		return nil, err
+	}
+	if options.Limit < 0 {
+		return nil, validationError("Limit must be non-negative")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	index, err := t.index(options.IndexName)
+	if err != nil {
+		return nil, err
+	}
+	if index.global && options.ConsistentRead {
+		return nil, validationError("Consistent reads are not supported on global secondary indexes")
+	}
+	schema := index.schema
+	hash, err := queryKey(keyCondition, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	type entry struct {
+		pk   string
+		item Item
+	}
+	var entries []entry
+	for pk, item := range t.items {
+		if v, ok := item[schema[0].AttributeName]; !ok || !v.Equal(hash) {
+			continue
+		}
+		if len(schema) > 1 {
+			if _, ok := item[schema[1].AttributeName]; !ok {
+				continue
+			}
+		}
+		if keyCondition.eval(item) {
+			entries = append(entries, entry{pk, item})
+		}
+	}
+	rangeOf := func(item map[string]AttributeValue) AttributeValue {
+		if len(schema) > 1 {
+			return item[schema[1].AttributeName]
+		}
+		return AttributeValue{}
+	}
+	forward := options.ScanIndexForward == nil || *options.ScanIndexForward
+	// compare orders entries by range key and then by primary key, in the
+	// direction of the query.
+	compare := func(a entry, b entry) int {
+		n, _ := compareValues(rangeOf(a.item), rangeOf(b.item))
+		if n == 0 {
+			n = strings.Compare(a.pk, b.pk)
+		}
+		if !forward {
+			n = -n
+		}
+		return n
+	}
+	sort.Slice(entries, func(i, j int) bool { return compare(entries[i], entries[j]) < 0 })
+	if options.ExclusiveStartKey != nil {
+		pk, err := t.keyString(options.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+		start := entry{pk, Item(options.ExclusiveStartKey)}
+		for len(entries) > 0 && compare(entries[0], start) <= 0 {
+			entries = entries[1:]
+		}
+	}
+
+	r := QueryResult{}
+	if options.Limit > 0 && len(entries) > options.Limit {
+		entries = entries[:options.Limit]
+		last := entries[len(entries)-1].item
+		r.LastEvaluatedKey = keyOf(last, t.description.KeySchema)
+		for k, v := range keyOf(last, schema) {
+			r.LastEvaluatedKey[k] = v
+		}
+	}
+	items := make([]Item, len(entries))
+	for i, e := range entries {
+		items[i] = index.project(e.item, t.description.KeySchema)
+	}
+	r.Items, r.Count = filterItems(items, filter, paths, options.Select)
+	r.Items = cloneItems(r.Items)
+	r.LastEvaluatedKey = Key(cloneItem(r.LastEvaluatedKey))
+	return &r, nil
+}
+
+func (b *memory) TransactGetItems(transactItems []TransactGetItem, options *TransactGetItemsOptions) (*TransactGetItemsResult, error) {
+	return b.TransactGetItemsWithContext(context.Background(), transactItems, options)
+}
+
+// TransactGetItemsWithContext reads every item under one lock, so that the
+// items are a consistent snapshot.
+func (b *memory) TransactGetItemsWithContext(ctx context.Context, transactItems []TransactGetItem, options *TransactGetItemsOptions) (*TransactGetItemsResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(transactItems) == 0 || len(transactItems) > maxTransactItems {
+		return nil, validationError("Member must have length less than or equal to 100 and greater than or equal to 1: TransactItems")
+	}
+	paths := make([][]docPath, len(transactItems))
+	for i, item := range transactItems {
+		if item.Get == nil {
+			return nil, validationError("TransactItems can only contain Get")
+		}
+		exprs := newExprContext(item.Get.ExpressionAttributeNames, nil)
+		var err error
+		if paths[i], err = projection(nil, item.Get.ProjectionExpression, exprs); err != nil {
+			return nil, err
+		}
+		if err := exprs.unused(); err != nil {
+			return nil, err
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := TransactGetItemsResult{Responses: make([]ItemResponse, len(transactItems))}
+	for i, item := range transactItems {
+		t, err := b.table(item.Get.TableName)
+		if err != nil {
+			return nil, err
+		}
+		pk, err := t.key(item.Get.Key)
+		if err != nil {
+			return nil, err
+		}
+		if found, ok := t.items[pk]; ok {
+			r.Responses[i].Item = cloneItem(project(found, paths[i]))
+		}
+	}
+	return &r, nil
+}
+
+// maxTransactItems is the most items a transaction may hold.
+const maxTransactItems = 100
+
+// transactTokenTTL is how long a ClientRequestToken makes
+// TransactWriteItems idempotent.
+const transactTokenTTL = 10 * time.Minute
+
+// transactToken records a transaction that succeeded with a
+// ClientRequestToken.
+type transactToken struct {
+	request []byte // the transaction's items, as JSON
+	expires time.Time
+}
+
+// transactWrite is one parsed action of a TransactWriteItems request.
+type transactWrite struct {
+	tableName string
+	key       Key
+	put       Item    // the item a Put writes
+	update    *update // the update an Update applies
+	delete    bool
+	condition condition
+	returnOld bool // return the item if condition fails
+}
+
+func parseTransactWrite(item TransactWriteItem) (transactWrite, error) {
+	var (
+		w           transactWrite
+		actions     int
+		expression  string
+		names       map[string]string
+		values      map[string]AttributeValue
+		returnValue string
+	)
+	if c := item.ConditionCheck; c != nil {
+		actions++
+		w.tableName, w.key, expression, names, values, returnValue = c.TableName, c.Key, c.ConditionExpression, c.ExpressionAttributeNames, c.ExpressionAttributeValues, c.ReturnValuesOnConditionCheckFailure
+		if expression == "" {
+			return w, validationError("ConditionCheck requires a ConditionExpression")
+		}
+	}
+	if d := item.Delete; d != nil {
+		actions++
+		w.tableName, w.key, expression, names, values, returnValue = d.TableName, d.Key, d.ConditionExpression, d.ExpressionAttributeNames, d.ExpressionAttributeValues, d.ReturnValuesOnConditionCheckFailure
+		w.delete = true
+	}
+	if p := item.Put; p != nil {
+		actions++
+		w.tableName, w.put, expression, names, values, returnValue = p.TableName, p.Item, p.ConditionExpression, p.ExpressionAttributeNames, p.ExpressionAttributeValues, p.ReturnValuesOnConditionCheckFailure
+	}
+	if u := item.Update; u != nil {
+		actions++
+		w.tableName, w.key, expression, names, values, returnValue = u.TableName, u.Key, u.ConditionExpression, u.ExpressionAttributeNames, u.ExpressionAttributeValues, u.ReturnValuesOnConditionCheckFailure
+		if u.UpdateExpression == "" {
+			return w, validationError("Update requires an UpdateExpression")
+		}
+	}
+	if actions != 1 {
+		return w, validationError("TransactItems can only contain one of ConditionCheck, Put, Update or Delete")
+	}
+	switch returnValue {
+	case "", "NONE":
+	case "ALL_OLD":
+		w.returnOld = true
+	default:
+		return w, validationError("Invalid ReturnValuesOnConditionCheckFailure: " + returnValue)
+	}
+	exprs := newExprContext(names, values)
+	var err error
+	if expression != "" {
+		if w.condition, err = parseCondition("ConditionExpression", expression, exprs); err != nil {
+			return w, err
+		}
+	}
+	if item.Update != nil {
+		if w.update, err = parseUpdate(item.Update.UpdateExpression, exprs); err != nil {
+			return w, err
+		}
+	}
+	return w, exprs.unused()
+}
+
+func (b *memory) TransactWriteItems(transactItems []TransactWriteItem, options *TransactWriteItemsOptions) (*TransactWriteItemsResult, error) {
+	return b.TransactWriteItemsWithContext(context.Background(), transactItems, options)
+}
+
+// TransactWriteItemsWithContext checks every condition before applying any
+// write, so that either all of the writes are applied or none are.
+func (b *memory) TransactWriteItemsWithContext(ctx context.Context, transactItems []TransactWriteItem, options *TransactWriteItemsOptions) (*TransactWriteItemsResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &TransactWriteItemsOptions{}
+	}
+	if len(transactItems) == 0 || len(transactItems) > maxTransactItems {
+		return nil, validationError("Member must have length less than or equal to 100 and greater than or equal to 1: TransactItems")
+	}
+	writes := make([]transactWrite, len(transactItems))
+	for i, item := range transactItems {
+		var err error
+		if writes[i], err = parseTransactWrite(item); err != nil {
+			return nil, err
+		}
+	}
+	request, err := json.Marshal(transactItems)
+	if err != nil {
+		return nil, validationError(err.Error())
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for token, t := range b.tokens {
+		if now.After(t.expires) {
+			delete(b.tokens, token)
+		}
+	}
+	if t, ok := b.tokens[options.ClientRequestToken]; ok {
+		if !bytes.Equal(t.request, request) {
+			return nil, &APIError{Code: ErrIdempotentParameterMismatch.Code, Message: "Request token " + options.ClientRequestToken + " was used with different parameters", StatusCode: 400}
+		}
+		return &TransactWriteItemsResult{}, nil
+	}
+
+	tables := make([]*table, len(writes))
+	pks := make([]string, len(writes))
+	seen := make(map[string]bool)
+	for i, w := range writes {
+		t, err := b.table(w.tableName)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case w.put != nil:
+			pks[i], err = t.keyString(w.put)
+		case w.update != nil:
+			pks[i], err = t.updateKey(w.key, w.update)
+		default:
+			pks[i], err = t.key(w.key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if seen[w.tableName+"\x00"+pks[i]] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[w.tableName+"\x00"+pks[i]] = true
+		tables[i] = t
+	}
+
+	items := make([]Item, len(writes))
+	reasons := make([]CancellationReason, len(writes))
+	canceled := false
+	for i, w := range writes {
+		reasons[i].Code = "None"
+		old := tables[i].items[pks[i]]
+		if w.condition != nil && !w.condition.eval(old) {
+			reasons[i] = CancellationReason{Code: "ConditionalCheckFailed", Message: "The conditional request failed"}
+			if w.returnOld {
+				reasons[i].Item = cloneItem(old)
+			}
+			canceled = true
+			continue
+		}
+		switch {
+		case w.put != nil:
+			items[i] = w.put
+		case w.update != nil:
+			item, err := updated(old, w.key, w.update)
+			if err != nil {
+				reasons[i] = CancellationReason{Code: "ValidationError", Message: err.Error()}
+				var apiErr *APIError
+				if errors.As(err, &apiErr) {
+					reasons[i].Message = apiErr.Message
+				}
+				canceled = true
+				continue
+			}
+			items[i] = item
+		}
+	}
+	if canceled {
+		codes := make([]string, len(reasons))
+		for i, reason := range reasons {
+			codes[i] = reason.Code
+		}
+		return nil, &APIError{
+			Code:                ErrTransactionCanceled.Code,
+			Message:             "Transaction cancelled, please refer cancellation reasons for specific reasons [" + strings.Join(codes, ", ") + "]",
+			StatusCode:          400,
+			CancellationReasons: reasons,
+		}
+	}
+
+	for i, w := range writes {
+		switch {
+		case w.delete:
+			delete(tables[i].items, pks[i])
+		case items[i] != nil:
+			tables[i].items[pks[i]] = cloneItem(items[i])
+		}
+	}
+	if options.ClientRequestToken != "" {
+		if b.tokens == nil {
+			b.tokens = make(map[string]transactToken)
+		}
+		b.tokens[options.ClientRequestToken] = transactToken{request, now.Add(transactTokenTTL)}
+	}
+	return &TransactWriteItemsResult{}, nil
 }
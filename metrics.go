@@ -0,0 +1,244 @@
+package dynamodb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements from a client. Implementations must be
+// safe for concurrent use.
+type Metrics interface {
+	// Request is called once per operation with its latency, including
+	// any retries, and its final error.
+	Request(operation, table string, latency time.Duration, err error)
+
+	// Retry is called each time operation is retried after err.
+	Retry(operation, table string, err error)
+
+	// Capacity is called with the capacity units a successful operation
+	// consumed in table, when the response reports them.
+	Capacity(operation, table string, read, write float64)
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of a Collector's latency
+// histograms.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector is an in-process Metrics. It can be published with expvar,
+// whose String method it provides, and serves the Prometheus text format
+// over HTTP.
+type Collector struct {
+	Buckets []float64 // nil means DefaultBuckets
+
+	mu         sync.Mutex
+	operations map[OperationKey]*OperationStats
+}
+
+// OperationKey identifies the measurements of an operation on a table.
+type OperationKey struct {
+	Operation string
+	Table     string
+}
+
+// OperationStats are the measurements collected for one OperationKey.
+type OperationStats struct {
+	Requests   int64
+	Errors     map[string]int64 // by error code
+	Retries    int64
+	Throttles  int64
+	ReadUnits  float64
+	WriteUnits float64
+	Latency    Histogram
+}
+
+// Histogram counts observations, in seconds, at or below each bucket's
+// upper bound.
+type Histogram struct {
+	Buckets []float64
+	Counts  []int64 // cumulative, one per bucket
+	Count   int64
+	Sum     float64
+}
+
+func (h *Histogram) observe(v float64) {
+	for i, b := range h.Buckets {
+		if v <= b {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += v
+}
+
+func (c *Collector) stats(operation, table string) *OperationStats {
+	if c.operations == nil {
+		c.operations = make(map[OperationKey]*OperationStats)
+	}
+	k := OperationKey{operation, table}
+	s, ok := c.operations[k]
+	if !ok {
+		buckets := c.Buckets
+		if buckets == nil {
+			buckets = DefaultBuckets
+		}
+		s = &OperationStats{Errors: make(map[string]int64), Latency: Histogram{Buckets: buckets, Counts: make([]int64, len(buckets))}}
+		c.operations[k] = s
+	}
+	return s
+}
+
+func errorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return "ClientError"
+}
+
+func (c *Collector) Request(operation, table string, latency time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats(operation, table)
+	s.Requests++
+	s.Latency.observe(latency.Seconds())
+	if err != nil {
+		s.Errors[errorCode(err)]++
+		if IsThrottle(err) {
+			s.Throttles++
+		}
+	}
+}
+
+func (c *Collector) Retry(operation, table string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats(operation, table)
+	s.Retries++
+	if IsThrottle(err) {
+		s.Throttles++
+	}
+}
+
+func (c *Collector) Capacity(operation, table string, read, write float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats(operation, table)
+	s.ReadUnits += read
+	s.WriteUnits += write
+}
+
+// Snapshot returns a copy of everything collected so far.
+func (c *Collector) Snapshot() map[OperationKey]OperationStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := make(map[OperationKey]OperationStats, len(c.operations))
+	for k, s := range c.operations {
+		copied := *s
+		copied.Errors = make(map[string]int64, len(s.Errors))
+		for code, n := range s.Errors {
+			copied.Errors[code] = n
+		}
+		copied.Latency.Counts = append([]int64(nil), s.Latency.Counts...)
+		snapshot[k] = copied
+	}
+	return snapshot
+}
+
+func (c *Collector) sortedSnapshot() ([]OperationKey, map[OperationKey]OperationStats) {
+	snapshot := c.Snapshot()
+	keys := make([]OperationKey, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Operation != keys[j].Operation {
+			return keys[i].Operation < keys[j].Operation
+		}
+		return keys[i].Table < keys[j].Table
+	})
+	return keys, snapshot
+}
+
+// String returns the collected stats as JSON, satisfying expvar.Var.
+func (c *Collector) String() string {
+	keys, snapshot := c.sortedSnapshot()
+	type entry struct {
+		OperationKey
+		OperationStats
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = entry{k, snapshot[k]}
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// ServeHTTP writes the collected stats in the Prometheus text format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WritePrometheus(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(k OperationKey, extra ...string) string {
+	s := `operation="` + labelEscaper.Replace(k.Operation) + `",table="` + labelEscaper.Replace(k.Table) + `"`
+	for i := 0; i+1 < len(extra); i += 2 {
+		s += "," + extra[i] + `="` + labelEscaper.Replace(extra[i+1]) + `"`
+	}
+	return "{" + s + "}"
+}
+
+// WritePrometheus writes the collected stats to w in the Prometheus text
+// format.
+func (c *Collector) WritePrometheus(w io.Writer) error {
+	keys, snapshot := c.sortedSnapshot()
+	var b strings.Builder
+	counter := func(name, help string, value func(OperationStats) float64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s%s %g\n", name, labels(k), value(snapshot[k]))
+		}
+	}
+	counter("dynamodb_requests_total", "Operations completed, however many attempts they took.", func(s OperationStats) float64 { return float64(s.Requests) })
+	counter("dynamodb_retries_total", "Attempts retried.", func(s OperationStats) float64 { return float64(s.Retries) })
+	counter("dynamodb_throttles_total", "Attempts rejected for exceeding throughput.", func(s OperationStats) float64 { return float64(s.Throttles) })
+	counter("dynamodb_consumed_read_capacity_units_total", "Read capacity units consumed.", func(s OperationStats) float64 { return s.ReadUnits })
+	counter("dynamodb_consumed_write_capacity_units_total", "Write capacity units consumed.", func(s OperationStats) float64 { return s.WriteUnits })
+
+	fmt.Fprintf(&b, "# HELP dynamodb_errors_total Operations that failed, by error code.\n# TYPE dynamodb_errors_total counter\n")
+	for _, k := range keys {
+		codes := make([]string, 0, len(snapshot[k].Errors))
+		for code := range snapshot[k].Errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "dynamodb_errors_total%s %d\n", labels(k, "code", code), snapshot[k].Errors[code])
+		}
+	}
+
+	fmt.Fprintf(&b, "# HELP dynamodb_request_duration_seconds Operation latency, including retries.\n# TYPE dynamodb_request_duration_seconds histogram\n")
+	for _, k := range keys {
+		h := snapshot[k].Latency
+		for i, bound := range h.Buckets {
+			fmt.Fprintf(&b, "dynamodb_request_duration_seconds_bucket%s %d\n", labels(k, "le", fmt.Sprint(bound)), h.Counts[i])
+		}
+		fmt.Fprintf(&b, "dynamodb_request_duration_seconds_bucket%s %d\n", labels(k, "le", "+Inf"), h.Count)
+		fmt.Fprintf(&b, "dynamodb_request_duration_seconds_sum%s %g\n", labels(k), h.Sum)
+		fmt.Fprintf(&b, "dynamodb_request_duration_seconds_count%s %d\n", labels(k), h.Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
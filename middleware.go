@@ -0,0 +1,43 @@
+package dynamodb
+
+import (
+	"net/http"
+)
+
+// Request is a single attempt at an action, as seen by middleware.
+type Request struct {
+	Operation  string // e.g. "GetItem"
+	TableName  string // "" for batch actions
+	Attempt    int    // counting from 1
+	Parameters []byte // the marshalled JSON body
+
+	// HTTPRequest is unsigned on its way in: the client signs it unless a
+	// middleware has already set an Authorization header.
+	HTTPRequest *http.Request
+
+	// HTTPResponse and ResponseBody are set once a response has arrived;
+	// the body has already been read.
+	HTTPResponse *http.Response
+	ResponseBody []byte
+}
+
+// Handler sends a Request, returning the transport error or the decoded
+// *APIError if it failed.
+type Handler func(r *Request) error
+
+// Middleware wraps a Handler with cross-cutting behaviour such as tracing
+// or auditing.
+type Middleware func(next Handler) Handler
+
+// Use appends middleware to the chain run around every attempt; the first
+// middleware used is the outermost.
+func (c *Config) Use(middleware ...Middleware) {
+	c.Middleware = append(c.Middleware, middleware...)
+}
+
+func chain(handler Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,173 @@
+package dynamodb
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a client side token bucket per table, shared by every
+// caller of the client it is configured on. Tokens are capacity units: each
+// request takes one before it is sent and the rest of its ConsumedCapacity
+// once the response arrives. The client asks for ReturnConsumedCapacity
+// TOTAL on requests that leave it unset, and leaves the ConsumedCapacity
+// out of their results.
+//
+// The rate of each bucket is adjusted AIMD style: it grows additively with
+// each successful request and is cut multiplicatively on every throttle.
+//
+// The zero value is usable: every field left 0 takes the default given
+// beside it.
+type RateLimiter struct {
+	InitialRate float64       // capacity units per second for a new table; 0 means 25
+	MinRate     float64       // 0 means 1
+	MaxRate     float64       // 0 means unlimited
+	Increase    float64       // units per second gained per second at full utilization; 0 means InitialRate/20, at least 1
+	Decrease    float64       // factor applied to the rate on a throttle; 0 means 0.5
+	Burst       time.Duration // how much unused rate may be saved up; 0 means a second
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// RateLimiterStats describes the state of one table's bucket.
+type RateLimiterStats struct {
+	Rate      float64 // current capacity units per second
+	Tokens    float64 // negative while callers are waiting
+	Consumed  float64 // capacity units consumed so far
+	Requests  int64
+	Throttles int64
+	Waits     int64         // requests that had to wait for tokens
+	Waited    time.Duration // total time spent waiting
+}
+
+type bucket struct {
+	RateLimiterStats
+	last time.Time
+}
+
+// NewRateLimiter returns a limiter starting every table at initial capacity
+// units per second and keeping it within [min, max].
+func NewRateLimiter(initial, min, max float64) *RateLimiter {
+	return &RateLimiter{InitialRate: initial, MinRate: min, MaxRate: max, Increase: math.Max(1, initial/20), Decrease: 0.5, Burst: time.Second}
+}
+
+// limits returns l's rates and factors with the defaults applied.
+func (l *RateLimiter) limits() (initial, min, max, increase, decrease float64) {
+	min, max = l.MinRate, l.MaxRate
+	if min <= 0 {
+		min = 1
+	}
+	if max <= 0 {
+		max = math.Inf(1)
+	}
+	initial = l.InitialRate
+	if initial <= 0 {
+		initial = 25
+	}
+	initial = math.Min(max, math.Max(min, initial))
+	increase, decrease = l.Increase, l.Decrease
+	if increase <= 0 {
+		increase = math.Max(1, initial/20)
+	}
+	if decrease <= 0 {
+		decrease = 0.5
+	}
+	return initial, min, max, increase, decrease
+}
+
+// bucket returns the refilled bucket for table; l.mu must be held.
+func (l *RateLimiter) bucket(table string) *bucket {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	now := time.Now()
+	b, ok := l.buckets[table]
+	if !ok {
+		b = &bucket{last: now}
+		b.Rate, _, _, _, _ = l.limits()
+		b.Tokens = l.burst(b.Rate)
+		l.buckets[table] = b
+	}
+	b.Tokens = math.Min(l.burst(b.Rate), b.Tokens+b.Rate*now.Sub(b.last).Seconds())
+	b.last = now
+	return b
+}
+
+func (l *RateLimiter) burst(rate float64) float64 {
+	burst := l.Burst
+	if burst <= 0 {
+		burst = time.Second
+	}
+	return math.Max(1, rate*burst.Seconds())
+}
+
+// Wait takes a token from table's bucket, blocking until one is available
+// or ctx is done. A canceled Wait returns its token and is not counted in
+// the table's stats.
+func (l *RateLimiter) Wait(ctx context.Context, table string) error {
+	l.mu.Lock()
+	b := l.bucket(table)
+	b.Requests++
+	b.Tokens--
+	if b.Tokens >= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	wait := time.Duration(-b.Tokens / b.Rate * float64(time.Second))
+	b.Waits++
+	b.Waited += wait
+	l.mu.Unlock()
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		b := l.bucket(table)
+		b.Tokens++
+		b.Requests--
+		b.Waits--
+		b.Waited -= wait
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Consumed charges table for the units a successful request consumed
+// beyond the token it took in Wait, and grows the table's rate.
+func (l *RateLimiter) Consumed(table string, units float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(table)
+	b.Consumed += units
+	if units > 1 {
+		b.Tokens -= units - 1
+	}
+	_, _, max, increase, _ := l.limits()
+	b.Rate = math.Min(max, b.Rate+increase*math.Max(units, 1)/b.Rate)
+}
+
+// Throttled cuts table's rate after the service rejected a request for
+// exceeding its throughput.
+func (l *RateLimiter) Throttled(table string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(table)
+	b.Throttles++
+	_, min, _, _, decrease := l.limits()
+	b.Rate = math.Max(min, b.Rate*decrease)
+	b.Tokens = math.Min(b.Tokens, 0)
+}
+
+// Stats returns a snapshot of every table's bucket.
+func (l *RateLimiter) Stats() map[string]RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := make(map[string]RateLimiterStats, len(l.buckets))
+	for table := range l.buckets {
+		stats[table] = l.bucket(table).RateLimiterStats
+	}
+	return stats
+}
@@ -0,0 +1,139 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed request is sent again.
+type RetryPolicy interface {
+	// Retry is called after attempt (counting from 1) failed with err,
+	// elapsed since the first attempt began and previous being the delay
+	// that preceded this attempt. It returns the delay before the next
+	// attempt, or false if there should be none.
+	Retry(attempt int, elapsed, previous time.Duration, err error) (time.Duration, bool)
+}
+
+// Jitter selects how a BackoffRetryPolicy randomizes its delays.
+type Jitter int
+
+const (
+	// NoJitter waits BaseDelay*2^(attempt-1).
+	NoJitter Jitter = iota
+	// FullJitter waits a uniformly random time up to BaseDelay*2^(attempt-1).
+	FullJitter
+	// DecorrelatedJitter waits a uniformly random time between BaseDelay
+	// and three times the previous delay.
+	DecorrelatedJitter
+)
+
+// BackoffRetryPolicy retries retryable errors with capped exponential
+// backoff.
+type BackoffRetryPolicy struct {
+	MaxAttempts int           // including the first; 0 means unlimited
+	MaxElapsed  time.Duration // 0 means unlimited
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration // 0 means uncapped
+	Jitter      Jitter
+
+	// Codes overrides the retryability of *APIErrors by Code; codes not
+	// present are classified by IsRetryable.
+	Codes map[string]bool
+}
+
+// DefaultRetryPolicy is used when a Config has no RetryPolicy.
+var DefaultRetryPolicy RetryPolicy = &BackoffRetryPolicy{
+	MaxAttempts: 11,
+	MaxElapsed:  time.Minute,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    20 * time.Second,
+	Jitter:      FullJitter,
+}
+
+func (p *BackoffRetryPolicy) Retry(attempt int, elapsed, previous time.Duration, err error) (time.Duration, bool) {
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if !p.retryable(err) {
+		return 0, false
+	}
+	delay := p.delay(attempt, previous)
+	if p.MaxElapsed > 0 && elapsed+delay > p.MaxElapsed {
+		return 0, false
+	}
+	return delay, true
+}
+
+func (p *BackoffRetryPolicy) retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if retry, ok := p.Codes[apiErr.Code]; ok {
+			return retry
+		}
+	}
+	return IsRetryable(err)
+}
+
+func (p *BackoffRetryPolicy) delay(attempt int, previous time.Duration) time.Duration {
+	var d time.Duration
+	switch p.Jitter {
+	case DecorrelatedJitter:
+		if previous < p.BaseDelay {
+			previous = p.BaseDelay
+		}
+		d = p.BaseDelay + random(3*previous-p.BaseDelay)
+	default:
+		backoff := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+		if p.MaxDelay > 0 && backoff > float64(p.MaxDelay) {
+			backoff = float64(p.MaxDelay)
+		}
+		d = time.Duration(backoff)
+		if p.Jitter == FullJitter {
+			d = random(d)
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+func random(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// IsThrottle reports whether err reports that the caller is sending
+// requests faster than the table or account allows.
+func IsThrottle(err error) bool {
+	return errors.Is(err, ErrProvisionedThroughputExceeded) || errors.Is(err, ErrThrottling) || errors.Is(err, ErrRequestLimitExceeded)
+}
+
+// IsRetryable reports whether err is transient: a throttle, a server side
+// failure, a transaction still in progress under the same
+// ClientRequestToken, a broken connection or a corrupted response.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrAttemptTimeout) {
+		return true
+	}
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return IsThrottle(err) || apiErr.StatusCode >= 500 || errors.Is(err, ErrInternalServerError) || errors.Is(err, ErrServiceUnavailable) || errors.Is(err, ErrTransactionInProgress)
+	}
+	if errors.Is(err, ErrCRC32Mismatch) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
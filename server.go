@@ -0,0 +1,345 @@
+package dynamodb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrInvalidSignature is returned by a Server for requests whose signature
+// does not match its credentials.
+var ErrInvalidSignature = &APIError{Code: "InvalidSignatureException"}
+
+// Server serves the DynamoDB JSON 1.0 protocol, dispatching each request to
+// DB. It lets non-Go programs, and the HTTP client itself, be tested against
+// NewMemoryDB.
+type Server struct {
+	DB DynamoDB
+
+	// Credentials, if set, must have signed every request; otherwise
+	// signatures are not checked.
+	Credentials CredentialsProvider
+
+	// Logger receives a record of each failed request; nil means they are
+	// discarded.
+	Logger *slog.Logger
+
+	requests int64
+}
+
+// NewServer returns a Server for db that does not check signatures.
+func NewServer(db DynamoDB) *Server {
+	return &Server{DB: db}
+}
+
+const targetPrefix = "DynamoDB_20120810."
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := strconv.FormatInt(atomic.AddInt64(&s.requests, 1), 10)
+	w.Header().Set("X-Amzn-Requestid", requestID)
+	result, err := s.call(r)
+	if err != nil {
+		// Errors other than an APIError, such as a canceled context,
+		// are the request's fault and must not be retried; a 500 is
+		// only sent when DB panics.
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = &APIError{Code: ErrValidation.Code, Message: err.Error(), StatusCode: 400}
+		}
+		if apiErr.StatusCode == 0 {
+			apiErr.StatusCode = 400
+		}
+		if s.Logger != nil {
+			s.Logger.Info("request failed", "target", r.Header.Get("X-Amz-Target"), "request", requestID, "error", apiErr)
+		}
+		result = struct {
+			Type                string               `json:"__type"`
+			Message             string               `json:"message"`
+			CancellationReasons []CancellationReason `json:",omitempty"`
+		}{"com.amazonaws.dynamodb.v20120810#" + apiErr.Code, apiErr.Message, apiErr.CancellationReasons}
+		writeJSON(w, result, apiErr.StatusCode)
+		return
+	}
+	writeJSON(w, result, 200)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, status int) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b = []byte(`{"__type":"com.amazonaws.dynamodb.v20120810#InternalServerError"}`)
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.Header().Set("X-Amz-Crc32", strconv.FormatUint(uint64(crc32.ChecksumIEEE(b)), 10))
+	w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// call serves r, turning a panic into an InternalServerError.
+func (s *Server) call(r *http.Request) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &APIError{Code: ErrInternalServerError.Code, Message: fmt.Sprint(p), StatusCode: 500}
+		}
+	}()
+	return s.serve(r)
+}
+
+func (s *Server) serve(r *http.Request) (interface{}, error) {
+	if r.Method != "POST" {
+		return nil, &APIError{Code: "UnknownOperationException", StatusCode: 400}
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Credentials != nil {
+		if err := s.verify(r, body); err != nil {
+			return nil, err
+		}
+	}
+	target := r.Header.Get("X-Amz-Target")
+	if !strings.HasPrefix(target, targetPrefix) {
+		return nil, &APIError{Code: "UnknownOperationException", StatusCode: 400}
+	}
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(body, v); err != nil {
+			return &APIError{Code: ErrSerialization.Code, Message: err.Error(), StatusCode: 400}
+		}
+		return nil
+	}
+
+	ctx := r.Context()
+	switch target[len(targetPrefix):] {
+	case "BatchGetItem":
+		var p struct {
+			RequestItems map[string]KeysAndAttributes
+			BatchGetItemOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.BatchGetItemWithContext(ctx, p.RequestItems, &p.BatchGetItemOptions)
+	case "BatchWriteItem":
+		var p struct {
+			RequestItems map[string][]WriteRequest
+			BatchWriteItemOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.BatchWriteItemWithContext(ctx, p.RequestItems, &p.BatchWriteItemOptions)
+	case "CreateTable":
+		var p struct {
+			TableName             string
+			AttributeDefinitions  []AttributeDefinition
+			KeySchema             []KeySchemaElement
+			ProvisionedThroughput ProvisionedThroughput
+			CreateTableOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.CreateTableWithContext(ctx, p.TableName, p.AttributeDefinitions, p.KeySchema, p.ProvisionedThroughput, &p.CreateTableOptions)
+	case "DeleteItem":
+		var p struct {
+			TableName string
+			Key       Key
+			DeleteItemOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.DeleteItemWithContext(ctx, p.TableName, p.Key, &p.DeleteItemOptions)
+	case "DeleteTable":
+		var p struct {
+			TableName string
+			DeleteTableOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.DeleteTableWithContext(ctx, p.TableName, &p.DeleteTableOptions)
+	case "DescribeTable":
+		var p struct {
+			TableName string
+			DescribeTableOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.DescribeTableWithContext(ctx, p.TableName, &p.DescribeTableOptions)
+	case "GetItem":
+		var p struct {
+			TableName string
+			Key       Key
+			GetItemOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.GetItemWithContext(ctx, p.TableName, p.Key, &p.GetItemOptions)
+	case "ListTables":
+		var p ListTablesOptions
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.ListTablesWithContext(ctx, &p)
+	case "PutItem":
+		var p struct {
+			TableName string
+			Item      Item
+			PutItemOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.PutItemWithContext(ctx, p.TableName, p.Item, &p.PutItemOptions)
+	case "Query":
+		var p struct {
+			TableName string
+			QueryOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.QueryWithContext(ctx, p.TableName, &p.QueryOptions)
+	case "Scan":
+		var p struct {
+			TableName string
+			ScanOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.ScanWithContext(ctx, p.TableName, &p.ScanOptions)
+	case "TransactGetItems":
+		var p struct {
+			TransactItems []TransactGetItem
+			TransactGetItemsOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.TransactGetItemsWithContext(ctx, p.TransactItems, &p.TransactGetItemsOptions)
+	case "TransactWriteItems":
+		var p struct {
+			TransactItems []TransactWriteItem
+			TransactWriteItemsOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.TransactWriteItemsWithContext(ctx, p.TransactItems, &p.TransactWriteItemsOptions)
+	case "UpdateItem":
+		var p struct {
+			TableName string
+			Key       Key
+			UpdateItemOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.UpdateItemWithContext(ctx, p.TableName, p.Key, &p.UpdateItemOptions)
+	case "UpdateTable":
+		var p struct {
+			TableName             string
+			ProvisionedThroughput ProvisionedThroughput
+			UpdateTableOptions
+		}
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.DB.UpdateTableWithContext(ctx, p.TableName, p.ProvisionedThroughput, &p.UpdateTableOptions)
+	}
+	return nil, &APIError{Code: "UnknownOperationException", Message: target, StatusCode: 400}
+}
+
+// verify checks the AWS Signature Version 4 of r against s.Credentials.
+func (s *Server) verify(r *http.Request, body []byte) error {
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return &APIError{Code: ErrMissingAuthenticationToken.Code, Message: "Request is missing Authentication Token", StatusCode: 400}
+	}
+	const algorithm = "AWS4-HMAC-SHA256"
+	fields := make(map[string]string)
+	for _, f := range strings.Split(strings.TrimPrefix(authorization, algorithm+" "), ",") {
+		if i := strings.Index(f, "="); i > 0 {
+			fields[strings.TrimSpace(f[:i])] = strings.TrimSpace(f[i+1:])
+		}
+	}
+	credential := strings.SplitN(fields["Credential"], "/", 2)
+	date := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(authorization, algorithm+" ") || len(credential) != 2 || fields["SignedHeaders"] == "" || fields["Signature"] == "" || date == "" {
+		return &APIError{Code: ErrIncompleteSignature.Code, Message: "Authorization header is incomplete", StatusCode: 400}
+	}
+	c, err := s.Credentials.Retrieve(r.Context())
+	if err != nil {
+		return err
+	}
+	if credential[0] != c.AccessKeyID || r.Header.Get("X-Amz-Security-Token") != c.SessionToken {
+		return &APIError{Code: ErrUnrecognizedClient.Code, Message: "The security token included in the request is invalid", StatusCode: 400}
+	}
+	scope := credential[1]
+	parts := strings.Split(scope, "/")
+	if len(parts) != 4 || parts[3] != "aws4_request" {
+		return &APIError{Code: ErrIncompleteSignature.Code, Message: "Credential scope is malformed", StatusCode: 400}
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := strings.Join(r.Header.Values(h), ",")
+		if h == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{r.Method, path, canonicalQuery(r.URL.Query()), canonicalHeaders.String(), fields["SignedHeaders"], hex.EncodeToString(bodyHash[:])}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := algorithm + "\n" + date + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, p := range parts {
+		key = hmacSHA256(key, p)
+	}
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(fields["Signature"])) {
+		return &APIError{Code: ErrInvalidSignature.Code, Message: "The request signature we calculated does not match the signature you provided", StatusCode: 400}
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for k, vs := range query {
+		for _, v := range vs {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Replace(strings.Join(pairs, "&"), "+", "%20", -1)
+}
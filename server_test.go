@@ -0,0 +1,168 @@
+package dynamodb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eikeon/dynamodb"
+)
+
+func TestServer(t *testing.T) {
+	credentials := dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret", SessionToken: "token"}
+	server := dynamodb.NewServer(dynamodb.NewMemoryDB())
+	server.Credentials = credentials
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	db, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Endpoint: ts.URL, Credentials: credentials})
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := db.Register("FetchRequest", (*FetchRequest)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := dynamodb.ProvisionedThroughput{ReadCapacityUnits: 1, WriteCapacityUnits: 1}
+	if _, err := db.CreateTable(table.TableName, table.AttributeDefinitions, table.KeySchema, pt, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateTable(table.TableName, table.AttributeDefinitions, table.KeySchema, pt, nil); !errors.Is(err, dynamodb.ErrResourceInUse) {
+		t.Errorf("expected ErrResourceInUse, got %v", err)
+	}
+
+	f := &FetchRequest{Host: "example.com", URL: "http://example.com/", RequestedOn: "2013-01-01T00:00:00Z"}
+	if _, err := db.PutItem(table.TableName, db.ToItem(f), nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.GetItem(table.TableName, db.ToKey(f), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Item == nil || db.FromItem(table.TableName, *r.Item).(*FetchRequest).URL != f.URL {
+		t.Errorf("got %v", r.Item)
+	}
+	if d, err := db.DescribeTable(table.TableName, nil); err != nil || d.Table.ItemCount != 1 || d.Table.TableStatus != "ACTIVE" {
+		t.Errorf("unexpected description %+v, %v", d, err)
+	}
+	if _, err := db.DeleteItem(table.TableName, db.ToKey(f), nil); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := db.Scan(table.TableName, nil); err != nil || s.Count != 0 {
+		t.Errorf("expected an empty scan, got %+v, %v", s, err)
+	}
+	if _, err := db.GetItem("Missing", db.ToKey(f), nil); !errors.Is(err, dynamodb.ErrResourceNotFound) {
+		t.Errorf("expected ErrResourceNotFound, got %v", err)
+	}
+
+	other := &FetchRequest{Host: "example.org", URL: "http://example.org/", RequestedOn: "2013-01-01T00:00:00Z"}
+	if _, err := db.TransactWriteItems([]dynamodb.TransactWriteItem{
+		{ConditionCheck: &dynamodb.ConditionCheck{TableName: table.TableName, Key: db.ToKey(f), ConditionExpression: "attribute_exists(URL)"}},
+		{Put: &dynamodb.Put{TableName: table.TableName, Item: db.ToItem(other)}},
+	}, nil); !errors.Is(err, dynamodb.ErrTransactionCanceled) {
+		t.Errorf("expected ErrTransactionCanceled, got %v", err)
+	} else if apiErr := (*dynamodb.APIError)(nil); !errors.As(err, &apiErr) || len(apiErr.CancellationReasons) != 2 || apiErr.CancellationReasons[0].Code != "ConditionalCheckFailed" || apiErr.CancellationReasons[1].Code != "None" {
+		t.Errorf("unexpected cancellation reasons in %#v", err)
+	}
+	if g, err := db.TransactGetItems([]dynamodb.TransactGetItem{{Get: &dynamodb.Get{TableName: table.TableName, Key: db.ToKey(other)}}}, nil); err != nil || len(g.Responses) != 1 || g.Responses[0].Item != nil {
+		t.Errorf("the canceled put should not be applied: %+v, %v", g, err)
+	}
+
+	impostor, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Endpoint: ts.URL, Credentials: dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "wrong", SessionToken: "token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := impostor.DescribeTable(table.TableName, nil); !errors.Is(err, dynamodb.ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+// failingDB fails GetItem with a plain error, Query with a canceled context
+// and panics in Scan.
+type failingDB struct {
+	dynamodb.DynamoDB
+}
+
+func (failingDB) GetItemWithContext(ctx context.Context, tableName string, key dynamodb.Key, options *dynamodb.GetItemOptions) (*dynamodb.GetItemResult, error) {
+	return nil, fmt.Errorf("bad key %v", key)
+}
+
+func (failingDB) QueryWithContext(ctx context.Context, tableName string, options *dynamodb.QueryOptions) (*dynamodb.QueryResult, error) {
+	return nil, context.Canceled
+}
+
+func (failingDB) ScanWithContext(ctx context.Context, tableName string, options *dynamodb.ScanOptions) (*dynamodb.ScanResult, error) {
+	panic("broken")
+}
+
+func TestServerErrors(t *testing.T) {
+	ts := httptest.NewServer(dynamodb.NewServer(failingDB{}))
+	defer ts.Close()
+	db, err := dynamodb.NewDynamoDBWithConfig(dynamodb.Config{Endpoint: ts.URL, Credentials: dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := db.GetItem("T", dynamodb.Key{"Host": dynamodb.StringValue("example.com")}, nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a plain error to be a ValidationException, got %v", err)
+	}
+	if _, err := db.Query("T", nil); !errors.Is(err, dynamodb.ErrValidation) {
+		t.Errorf("expected a canceled context to be a ValidationException, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("client errors should not be retried, took %v", elapsed)
+	}
+
+	var apiErr *dynamodb.APIError
+	config := dynamodb.Config{Endpoint: ts.URL, Credentials: dynamodb.StaticCredentials{AccessKeyID: "key", SecretAccessKey: "secret"}, RetryPolicy: &dynamodb.BackoffRetryPolicy{MaxAttempts: 1}}
+	if db, err = dynamodb.NewDynamoDBWithConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Scan("T", nil); !errors.Is(err, dynamodb.ErrInternalServerError) || !errors.As(err, &apiErr) || apiErr.StatusCode != 500 {
+		t.Errorf("expected a panic to be a 500 InternalServerError, got %v", err)
+	}
+}
+
+func TestServerOmitsUnsetFields(t *testing.T) {
+	ts := httptest.NewServer(dynamodb.NewServer(dynamodb.NewMemoryDB()))
+	defer ts.Close()
+	post := func(action, body string) string {
+		request, err := http.NewRequest("POST", ts.URL, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("X-Amz-Target", "DynamoDB_20120810."+action)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		if response.StatusCode != 200 {
+			t.Fatalf("%s: %s", action, b)
+		}
+		return string(b)
+	}
+	for _, c := range []struct{ action, body string }{
+		{"ListTables", `{}`},
+		{"CreateTable", `{"TableName":"T","KeySchema":[{"AttributeName":"ID","KeyType":"HASH"}],"ProvisionedThroughput":{"ReadCapacityUnits":1,"WriteCapacityUnits":1}}`},
+		{"PutItem", `{"TableName":"T","Item":{"ID":{"S":"a"}}}`},
+		{"GetItem", `{"TableName":"T","Key":{"ID":{"S":"b"}}}`},
+		{"UpdateItem", `{"TableName":"T","Key":{"ID":{"S":"a"}},"UpdateExpression":"SET N = :n","ExpressionAttributeValues":{":n":{"N":"1"}}}`},
+		{"Query", `{"TableName":"T","KeyConditionExpression":"ID = :id","ExpressionAttributeValues":{":id":{"S":"b"}}}`},
+		{"Scan", `{"TableName":"T"}`},
+		{"DeleteItem", `{"TableName":"T","Key":{"ID":{"S":"a"}}}`},
+		{"DescribeTable", `{"TableName":"T"}`},
+	} {
+		if body := post(c.action, c.body); strings.Contains(body, "null") {
+			t.Errorf("%s: unset fields should be left out, got %s", c.action, body)
+		}
+	}
+}